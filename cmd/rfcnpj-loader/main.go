@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -10,18 +14,134 @@ import (
 
 	"github.com/abriciof/rfcnpj-loader/internal/app"
 	"github.com/abriciof/rfcnpj-loader/internal/config"
+	"github.com/abriciof/rfcnpj-loader/internal/redact"
 )
 
+// Exit codes, so cron and scripts can tell a load from a run with nothing to do.
+const (
+	exitOK       = 0 // the month was loaded, or the command succeeded
+	exitFailed   = 1
+	exitUsage    = 2 // unknown command, bad flag or invalid configuration
+	exitUpToDate = 3 // nothing to load: nothing new published, or skipped by the lock
+)
+
+const usageText = `uso: rfcnpj-loader [opções] [comando] [opções]
+
+comandos:
+  run              pipeline completo: lista, baixa, extrai, carrega (padrão)
+  download         só baixa os zips do mês
+  extract          só extrai os zips já baixados do mês
+  verify           confere os arquivos extraídos do mês (tabela e layout)
+  load             carrega os arquivos já extraídos, sem baixar nem extrair
+  plan             mostra o que run faria (tabelas, zips, disco) sem gravar nada
+  status           mês e linhas da última carga de cada tabela
+  list-months      meses publicados pela Receita
+  migrate status   migrações do schema do loader
+  migrate up       aplica as migrações pendentes
+  config validate  mostra a configuração efetiva e os problemas
+  help             esta ajuda
+
+códigos de saída: 0 carregado/ok, 1 falha, 2 uso ou configuração inválida, 3 nada a carregar
+(sem comando, como nas versões anteriores: 0 também quando não há nada a carregar e 1 para
+configuração inválida)
+
+opções:
+`
+
+// options are the command line flags, accepted before and after the command.
+type options struct {
+	configFile    string
+	envFile       string
+	tables        string
+	month         string
+	outputPath    string
+	extractedPath string
+	dryRun        bool
+}
+
+func (o *options) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.configFile, "config", "", "arquivo de configuração JSON (substitui CONFIG_FILE)")
+	fs.StringVar(&o.envFile, "env-file", "", "arquivo KEY=valor com variáveis ausentes do ambiente (substitui ENV_FILE)")
+	fs.StringVar(&o.tables, "tables", "", "tabelas a carregar, separadas por vírgula (só elas)")
+	fs.StringVar(&o.month, "month", "", "mês AAAA-MM (substitui FORCE_MONTH)")
+	fs.StringVar(&o.outputPath, "output-path", "", "diretório dos zips (substitui OUTPUT_FILES_PATH)")
+	fs.StringVar(&o.extractedPath, "extracted-path", "", "diretório dos arquivos extraídos (substitui EXTRACTED_FILES_PATH)")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "com run ou load: mostra o plano, como o comando plan")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usageText)
+		fs.PrintDefaults()
+	}
+}
+
+func (o options) overrides() config.Overrides {
+	ov := config.Overrides{
+		ConfigFile:    o.configFile,
+		EnvFile:       o.envFile,
+		Month:         o.month,
+		OutputPath:    o.outputPath,
+		ExtractedPath: o.extractedPath,
+	}
+	if o.tables != "" {
+		ov.Tables = strings.Split(o.tables, ",")
+	}
+	return ov
+}
+
 func main() {
-	cfg, err := config.Load()
+	var opts options
+	// os dois conjuntos são criados antes do parse: o segundo não pode
+	// repor os padrões por cima do que o primeiro leu
+	global := flag.NewFlagSet("rfcnpj-loader", flag.ExitOnError)
+	opts.bind(global)
+	sub := flag.NewFlagSet("rfcnpj-loader", flag.ExitOnError)
+	opts.bind(sub)
+
+	_ = global.Parse(os.Args[1:])
+	cmd, args := "run", global.Args()
+	// sem comando (o CMD do Docker): mantém os códigos de saída de antes
+	implicit := len(args) == 0
+	exit := func(code int) {
+		if implicit {
+			code = implicitExitCode(code)
+		}
+		os.Exit(code)
+	}
+	if len(args) > 0 {
+		cmd = args[0]
+		_ = sub.Parse(args[1:])
+		args = sub.Args()
+	}
+
+	switch {
+	case cmd == "help":
+		global.SetOutput(os.Stdout)
+		global.Usage()
+		return
+	case !commands[cmd]:
+		fmt.Fprintf(os.Stderr, "comando desconhecido %q\n\n", cmd)
+		global.Usage()
+		os.Exit(exitUsage)
+	}
+
+	// até a configuração ser lida, o log já esconde senhas em URLs
+	slog.SetDefault(newLogger(slog.LevelInfo))
+
+	cfg, err := config.LoadWith(opts.overrides())
+	redact.Add(cfg.Secrets()...)
+	if cmd == "config" && isCommand(args, "validate") {
+		// mostra a configuração mesmo com problemas
+		if err := app.ValidateConfig(cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, redact.String(err.Error()))
+			os.Exit(exitUsage)
+		}
+		return
+	}
 	if err != nil {
 		slog.Error("failed to load config", "error", err)
-		os.Exit(1)
+		exit(exitUsage)
 	}
 
-	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: parseLogLevel(cfg.LogLevel),
-	})))
+	slog.SetDefault(newLogger(parseLogLevel(cfg.LogLevel)))
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -35,10 +155,111 @@ func main() {
 		cancel()
 	}()
 
-	if err := app.Run(ctx, cfg); err != nil {
-		slog.Error("application run failed", "error", err)
-		os.Exit(1)
+	if opts.dryRun && (cmd == "run" || cmd == "load") {
+		if cmd == "load" {
+			cfg.EnableDownload, cfg.EnableExtract = false, false
+		}
+		cmd = "plan"
 	}
+	out, err := dispatch(ctx, cfg, cmd, args, os.Stdout)
+	var uerr usageError
+	if errors.As(err, &uerr) {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		global.Usage()
+		os.Exit(exitUsage)
+	}
+	if err != nil {
+		slog.Error("application run failed", "command", cmd, "error", err)
+	}
+	exit(exitCode(out, err))
+}
+
+// commands are the first words accepted after the options.
+var commands = map[string]bool{
+	"run": true, "download": true, "extract": true, "verify": true, "load": true, "plan": true,
+	"status": true, "list-months": true, "migrate": true, "config": true, "help": true,
+}
+
+// usageError is an unknown command or arguments a command doesn't take.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+// dispatch runs cmd. The commands that work on the data directories check
+// them first.
+func dispatch(ctx context.Context, cfg config.Config, cmd string, args []string, w io.Writer) (app.Outcome, error) {
+	pipeline := map[string]func(context.Context, config.Config) (app.Outcome, error){
+		"run":      app.Run,
+		"load":     app.Load,
+		"download": app.Download,
+		"extract":  app.Extract,
+	}
+	if run, ok := pipeline[cmd]; ok && len(args) == 0 {
+		if err := cfg.Validate(); err != nil {
+			return app.Done, err
+		}
+		return run(ctx, cfg)
+	}
+
+	switch {
+	case cmd == "plan" && len(args) == 0:
+		// sem Validate: a conferência dos diretórios grava um arquivo de teste
+		return app.Plan(ctx, cfg, w)
+	case cmd == "verify" && len(args) == 0:
+		if err := cfg.Validate(); err != nil {
+			return app.Done, err
+		}
+		return app.Done, app.Verify(cfg, w)
+	case cmd == "status" && len(args) == 0:
+		return app.Done, app.Status(ctx, cfg, w)
+	case cmd == "list-months" && len(args) == 0:
+		return app.Done, app.ListMonths(ctx, cfg, w)
+	case cmd == "migrate" && isCommand(args, "status"):
+		return app.Done, app.MigrateStatus(ctx, cfg, w)
+	case cmd == "migrate" && isCommand(args, "up"):
+		return app.Done, app.MigrateUp(ctx, cfg)
+	}
+	return app.Done, usageError{fmt.Sprintf("comando desconhecido %q", strings.TrimSpace(cmd+" "+strings.Join(args, " ")))}
+}
+
+// exitCode maps the result of a command to the exit codes above.
+func exitCode(out app.Outcome, err error) int {
+	var verr *config.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return exitUsage
+	case err != nil:
+		return exitFailed
+	case out == app.UpToDate:
+		return exitUpToDate
+	}
+	return exitOK
+}
+
+// implicitExitCode maps code to the exit codes of the versions without
+// commands, for a run started without one: nothing to load was a success and
+// an invalid configuration a failure.
+func implicitExitCode(code int) int {
+	switch code {
+	case exitUpToDate:
+		return exitOK
+	case exitUsage:
+		return exitFailed
+	}
+	return code
+}
+
+func isCommand(args []string, cmd ...string) bool {
+	return strings.Join(args, " ") == strings.Join(cmd, " ")
+}
+
+// newLogger logs JSON to stderr with secrets redacted. Stdout is left to the
+// reports of plan, verify, status, etc.
+func newLogger(level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact.ReplaceAttr,
+	}))
 }
 
 func parseLogLevel(v string) slog.Level {
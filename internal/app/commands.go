@@ -0,0 +1,303 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/abriciof/rfcnpj-loader/internal/config"
+	"github.com/abriciof/rfcnpj-loader/internal/dav"
+	"github.com/abriciof/rfcnpj-loader/internal/db"
+	"github.com/abriciof/rfcnpj-loader/internal/downloader"
+	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+	"github.com/abriciof/rfcnpj-loader/internal/migrate"
+	"github.com/abriciof/rfcnpj-loader/internal/scan"
+	"github.com/abriciof/rfcnpj-loader/internal/state"
+	"github.com/abriciof/rfcnpj-loader/internal/timeutil"
+)
+
+// The stage commands (download, extract, verify) run one stage on its own.
+// They don't take the lock nor write to the database, so they shouldn't run
+// on the same directories as a run.
+
+// Download downloads the zips of the month the next run would load, or of
+// FORCE_MONTH (--month).
+func Download(ctx context.Context, cfg config.Config) (Outcome, error) {
+	plan, items, err := commandPlan(ctx, cfg)
+	if err != nil {
+		return Done, err
+	}
+	if items == nil {
+		return UpToDate, nil
+	}
+	cfg.EnableDownload = true
+	n, err := downloadZips(ctx, cfg, items)
+	if err != nil {
+		return Done, err
+	}
+	slog.Info("download finished", "month", plan.Month.String(), "files", len(items), "bytes", n, "output_path", cfg.OutputFilesPath)
+	return Done, nil
+}
+
+// Extract extracts the downloaded zips of the month the next run would load,
+// or of FORCE_MONTH (--month).
+func Extract(ctx context.Context, cfg config.Config) (Outcome, error) {
+	plan, items, err := commandPlan(ctx, cfg)
+	if err != nil {
+		return Done, err
+	}
+	if items == nil {
+		return UpToDate, nil
+	}
+	cfg.EnableExtract = true
+	dir, err := extractZips(ctx, cfg, plan.Month, items)
+	if err != nil {
+		return Done, err
+	}
+	slog.Info("extract finished", "month", plan.Month.String(), "files", len(items), "dest_dir", dir)
+	return Done, nil
+}
+
+// commandPlan resolves the month like a run does and returns the zips of the
+// tables to load; items is nil when there is nothing to do. With FORCE_MONTH
+// the database isn't used; without it, the loaded months are only read, and
+// a database never loaded plans the first load from START_MONTH.
+func commandPlan(ctx context.Context, cfg config.Config) (monthPlan, []dav.Item, error) {
+	enabled := cfg.EnabledTables()
+	if len(enabled) == 0 {
+		slog.Warn("no tables enabled; nothing to do")
+		return monthPlan{}, nil, nil
+	}
+
+	var meta *state.MetaStore
+	if strings.TrimSpace(cfg.ForceMonth) == "" {
+		sqlDB, err := db.OpenSQL(ctx, cfg.DBOptions())
+		if err != nil {
+			return monthPlan{}, nil, err
+		}
+		defer sqlDB.Close()
+		if meta, err = readMeta(ctx, cfg, sqlDB); err != nil {
+			return monthPlan{}, nil, err
+		}
+	}
+
+	plan, err := resolveTargetMonth(ctx, cfg, meta, enabled)
+	if err != nil {
+		return plan, nil, err
+	}
+	if plan.Items == nil || !hasAnyTableToLoad(plan.ShouldLoad) {
+		slog.Info("up-to-date", "month", plan.Month.String())
+		return plan, nil, nil
+	}
+	items := downloader.FilterWanted(plan.Items, downloader.Wanted(plan.ShouldLoad))
+	for table, reason := range plan.Reasons {
+		slog.Info("table scheduled", "table", table, "reason", reason)
+	}
+	return plan, items, nil
+}
+
+// readMeta returns the meta store of cfg, or nil when nothing was loaded yet
+// in this database. It only reads. Databases set up before the migrations
+// have rfcnpj_meta without rfcnpj_schema_migrations until the next run, so
+// the table itself is looked up then.
+func readMeta(ctx context.Context, cfg config.Config, sqlDB *sql.DB) (*state.MetaStore, error) {
+	rep, err := migrate.Check(ctx, sqlDB, cfg.TargetSchema)
+	if err != nil {
+		return nil, err
+	}
+	if rep.Pending() == len(rep.Migrations) {
+		var exists bool
+		table := loaders.QualifiedIdent(cfg.TargetSchema, "rfcnpj_meta")
+		if err := sqlDB.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, nil
+		}
+	}
+	return state.NewMetaStore(sqlDB, cfg.TargetSchema).WithTableNames(cfg.TablePrefix, cfg.TableSuffix), nil
+}
+
+// Verify checks the files extracted for FORCE_MONTH (--month) or, without
+// it, for the latest month in EXTRACTED_FILES_PATH: which table each file
+// goes to and whether its content fits the table. It prints one line per
+// file and fails when a file can't be tied to a table or doesn't fit it.
+func Verify(cfg config.Config, w io.Writer) error {
+	month := strings.TrimSpace(cfg.ForceMonth)
+	if month == "" {
+		var err error
+		if month, err = latestExtractedMonth(cfg.ExtractedFilesPath); err != nil {
+			return err
+		}
+	}
+	ym, err := timeutil.ParseYearMonth(month)
+	if err != nil {
+		return fmt.Errorf("mês inválido: %w", err)
+	}
+	dir := filepath.Join(cfg.ExtractedFilesPath, ym.String())
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("mês %s não extraído: %w", ym, err)
+	}
+
+	scanned, err := scan.Scan(dir, ym.String())
+	if err != nil {
+		return err
+	}
+	tables := map[string]bool{}
+	for _, t := range cfg.EnabledTables() {
+		tables[t] = true
+	}
+	detections, err := scan.Verify(&scanned, loaders.All, tables)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tZIP\tTABLE\tCHECK")
+	for _, l := range scanned.Lineage {
+		check := l.Sniff
+		if check == "" {
+			check = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", relPath(dir, l.File), l.Zip, l.Table, check)
+	}
+	for _, f := range scanned.Unclassified {
+		fmt.Fprintf(tw, "%s\t\t?\tunclassified\n", relPath(dir, f))
+	}
+	tw.Flush()
+
+	var problems []string
+	for _, d := range detections {
+		if d.Status == scan.SniffMismatch {
+			problems = append(problems, d.String())
+		} else if d.Status == scan.SniffCorrected {
+			fmt.Fprintln(w, "aviso:", d.String())
+		}
+	}
+	for _, t := range cfg.EnabledTables() {
+		if len(scanned.Files[t]) == 0 {
+			fmt.Fprintf(w, "aviso: nenhum arquivo para a tabela %s\n", t)
+		}
+	}
+	if len(scanned.Unclassified) > 0 {
+		problems = append(problems, "arquivos sem tabela definida: "+strings.Join(scanned.Unclassified, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("arquivos de %s com problemas:\n%s", ym, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// latestExtractedMonth is the most recent YYYY-MM directory under root.
+func latestExtractedMonth(root string) (string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return "", err
+	}
+	var months []string
+	for _, e := range entries {
+		if _, err := timeutil.ParseYearMonth(e.Name()); e.IsDir() && err == nil {
+			months = append(months, e.Name())
+		}
+	}
+	if len(months) == 0 {
+		return "", fmt.Errorf("nenhum mês extraído em %s: informe --month", root)
+	}
+	sort.Strings(months)
+	return months[len(months)-1], nil
+}
+
+func relPath(dir, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil {
+		return rel
+	}
+	return file
+}
+
+// Status prints, for every table, the month and row count of its last load
+// as recorded in rfcnpj_meta. It only reads.
+func Status(ctx context.Context, cfg config.Config, w io.Writer) error {
+	sqlDB, err := db.OpenSQL(ctx, cfg.DBOptions())
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	meta, err := readMeta(ctx, cfg, sqlDB)
+	if err != nil {
+		return err
+	}
+	var rows []tableStatus
+	for _, t := range cfg.Tables {
+		st := tableStatus{Table: t.Spec().Relation(), Enabled: t.Enabled}
+		if meta != nil {
+			month, ok, err := meta.LoadedMonth(ctx, t.Name)
+			if err != nil {
+				return err
+			}
+			if ok {
+				st.Month = month.String()
+			}
+			n, ok, err := meta.LoadedRows(ctx, t.Name)
+			if err != nil {
+				return err
+			}
+			if ok {
+				st.Rows = strconv.FormatInt(n, 10)
+			}
+		}
+		rows = append(rows, st)
+	}
+	writeStatus(w, rows)
+	return nil
+}
+
+type tableStatus struct {
+	Table   string
+	Enabled bool
+	// Month and Rows are empty when the table was never loaded.
+	Month string
+	Rows  string
+}
+
+func writeStatus(w io.Writer, rows []tableStatus) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tENABLED\tMONTH\tROWS")
+	for _, r := range rows {
+		month, n := r.Month, r.Rows
+		if month == "" {
+			month = "-"
+		}
+		if n == "" {
+			n = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%t\t%s\t%s\n", r.Table, r.Enabled, month, n)
+	}
+	tw.Flush()
+}
+
+// ListMonths prints the months published in the share, one per line: the
+// folders next to the one DAV_LIST_URL_TEMPLATE points to.
+func ListMonths(ctx context.Context, cfg config.Config, w io.Writer) error {
+	root, _, ok := strings.Cut(cfg.DavListURLTemplate, "%s")
+	if !ok {
+		return errors.New("DAV_LIST_URL_TEMPLATE deve conter %s no lugar do mês")
+	}
+	months, err := dav.NewClient().ListMonths(ctx, root)
+	if err != nil {
+		return err
+	}
+	for _, m := range months {
+		fmt.Fprintln(w, m)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/config"
+	"github.com/abriciof/rfcnpj-loader/internal/extract"
+	"github.com/abriciof/rfcnpj-loader/internal/notify"
+	"github.com/abriciof/rfcnpj-loader/internal/redact"
+	runreport "github.com/abriciof/rfcnpj-loader/internal/report"
+)
+
+// failureNotifyTimeout bounds the failure notification, which is sent even
+// after the run context was cancelled.
+const failureNotifyTimeout = 30 * time.Second
+
+// StageError ties an error to the pipeline stage, and when known the table
+// and file, where it happened.
+type StageError struct {
+	Stage string
+	Table string
+	File  string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	var where []string
+	if e.Table != "" {
+		where = append(where, "tabela "+e.Table)
+	}
+	if e.File != "" {
+		where = append(where, "arquivo "+e.File)
+	}
+	if len(where) == 0 {
+		return fmt.Sprintf("etapa %s: %v", e.Stage, e.Err)
+	}
+	return fmt.Sprintf("etapa %s (%s): %v", e.Stage, strings.Join(where, ", "), e.Err)
+}
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// failureStage returns where err happened: the StageError in its chain, or
+// the stage that was running.
+func failureStage(rep *report, err error) StageError {
+	var se *StageError
+	if errors.As(err, &se) {
+		return *se
+	}
+	out := StageError{Stage: rep.Current, Err: err}
+	if out.Stage == "" {
+		out.Stage = "setup"
+	}
+	var unsafe *extract.UnsafeArchiveError
+	if errors.As(err, &unsafe) {
+		out.File = unsafe.Zip
+	}
+	return out
+}
+
+func notifyFailure(ctx context.Context, cfg config.Config, n *notify.Multi, msgs *messages, rep *report, err error) {
+	interrupted := rep.Status == runreport.StatusInterrupted
+
+	// o contexto da execução pode já estar cancelado (SIGTERM)
+	nctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), failureNotifyTimeout)
+	defer cancel()
+	ev, rerr := msgs.failed(*rep, err, interrupted)
+	logRenderError(ev.Kind, rerr)
+	attachReport(cfg, rep, err, &ev)
+	sendNotification(nctx, n, ev)
+}
+
+// errorChain lists the messages of err and of every error it wraps, from the
+// outermost to the root cause.
+func errorChain(err error) []string {
+	var out []string
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		msg := redact.String(e.Error())
+		if len(out) > 0 && out[len(out)-1] == msg {
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out
+}
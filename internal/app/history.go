@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/redact"
+	"github.com/abriciof/rfcnpj-loader/internal/state"
+)
+
+const historyWriteTimeout = 10 * time.Second
+
+// runHistory writes the run to rfcnpj_runs and rfcnpj_run_stages as the
+// pipeline moves forward. A nil *runHistory does nothing, and write errors
+// are only logged: the history never fails a run.
+type runHistory struct {
+	store *state.RunStore
+	id    int64
+	// the writes outlive the cancellation of the run (SIGTERM), so the
+	// failed stage and the final status are still recorded
+	ctx context.Context
+}
+
+// startHistory inserts the run and the stages that began before the database
+// could be written (connect, lock).
+func startHistory(ctx context.Context, store *state.RunStore, trigger string, rep *report) *runHistory {
+	h := &runHistory{store: store, ctx: context.WithoutCancel(ctx)}
+	err := h.write(func(ctx context.Context) (err error) {
+		h.id, err = store.Start(ctx, trigger, rep.StartedAt)
+		return err
+	})
+	if err != nil {
+		return nil
+	}
+	slog.Info("run recorded", "run_id", h.id, "trigger", trigger)
+	for _, st := range rep.Stages {
+		h.beginStage(st.Name, st.started)
+		h.endStage(st.Name, state.StageDone, st.started.Add(st.Duration), "")
+	}
+	if rep.Current != "" {
+		h.beginStage(rep.Current, rep.currentStart)
+	}
+	return h
+}
+
+// runID is the rfcnpj_runs id, or 0 when the run isn't recorded.
+func (h *runHistory) runID() int64 {
+	if h == nil {
+		return 0
+	}
+	return h.id
+}
+
+func (h *runHistory) setMonth(month string) {
+	if h == nil {
+		return
+	}
+	_ = h.write(func(ctx context.Context) error { return h.store.SetMonth(ctx, h.id, month) })
+}
+
+func (h *runHistory) beginStage(stage string, at time.Time) {
+	if h == nil {
+		return
+	}
+	_ = h.write(func(ctx context.Context) error { return h.store.BeginStage(ctx, h.id, stage, at) })
+}
+
+func (h *runHistory) endStage(stage, status string, at time.Time, errText string) {
+	if h == nil {
+		return
+	}
+	_ = h.write(func(ctx context.Context) error { return h.store.EndStage(ctx, h.id, stage, status, at, errText) })
+}
+
+// finish closes the stage that was running when err happened and stores the
+// outcome of the run. rep.Status and rep.FinishedAt must already be set.
+func (h *runHistory) finish(rep *report, err error) {
+	if h == nil {
+		return
+	}
+	res := state.RunResult{
+		Status:          rep.Status,
+		FinishedAt:      rep.FinishedAt,
+		BytesDownloaded: rep.BytesDownloaded,
+		TableRows:       rep.LoadedRows,
+	}
+	if err != nil {
+		res.Error = redact.String(err.Error())
+		if rep.Current != "" {
+			h.endStage(rep.Current, state.StageFailed, rep.FinishedAt, res.Error)
+		}
+	}
+	_ = h.write(func(ctx context.Context) error { return h.store.Finish(ctx, h.id, res) })
+}
+
+func (h *runHistory) write(fn func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(h.ctx, historyWriteTimeout)
+	defer cancel()
+	err := fn(ctx)
+	if err != nil {
+		slog.Warn("could not record run history", "run_id", h.id, "error", err)
+	}
+	return err
+}
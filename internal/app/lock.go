@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/config"
+	"github.com/abriciof/rfcnpj-loader/internal/db"
+)
+
+// errRunSkipped ends the run without error: LOCK_MODE=skip and another run
+// holds the lock.
+var errRunSkipped = errors.New("outra execução em andamento; execução ignorada (LOCK_MODE=skip)")
+
+// acquireRunLock takes the loader advisory lock so that two instances never
+// load the same tables at once; instances with different TARGET_SCHEMA use
+// different locks. The key only depends on TARGET_SCHEMA: two instances of
+// different TARGET_SCHEMA whose config file puts a table in the same schema
+// don't exclude each other. With LOCK_MODE=wait (default) it waits for
+// the other run, up to LOCK_WAIT_TIMEOUT_SECONDS when set; skip returns
+// errRunSkipped and fail a *db.LockBusyError. LOCK_MODE was checked with the
+// config.
+func acquireRunLock(ctx context.Context, cfg config.Config, sqlDB *sql.DB) (*db.AdvisoryLock, error) {
+	lock, err := db.NewAdvisoryLock(ctx, sqlDB, db.LockKey(cfg.TargetSchema))
+	if err != nil {
+		return nil, err
+	}
+	ok, err := lock.TryAcquire(ctx)
+	if err != nil {
+		_ = lock.Release()
+		return nil, err
+	}
+	if ok {
+		return lock, nil
+	}
+
+	holder, err := lock.Holder(ctx)
+	if err != nil {
+		slog.Warn("could not identify the advisory lock holder", "error", err)
+	}
+	attrs := []any{"mode", cfg.LockMode}
+	if holder != nil {
+		attrs = append(attrs, "holder_pid", holder.PID, "holder_application", holder.Application,
+			"holder_client", holder.ClientAddr, "holder_since", holder.Since)
+	}
+	slog.Warn("another run holds the advisory lock", attrs...)
+
+	switch cfg.LockMode {
+	case "skip":
+		_ = lock.Release()
+		return nil, errRunSkipped
+	case "fail":
+		_ = lock.Release()
+		return nil, &db.LockBusyError{Holder: holder}
+	}
+
+	wctx := ctx
+	if cfg.LockWaitTimeout > 0 {
+		var cancel context.CancelFunc
+		wctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.LockWaitTimeout)*time.Second)
+		defer cancel()
+	}
+	start := time.Now()
+	if err := lock.Acquire(wctx); err != nil {
+		_ = lock.Release()
+		if ctx.Err() == nil && wctx.Err() != nil {
+			return nil, fmt.Errorf("tempo de espera do lock esgotado (%ds): %w", cfg.LockWaitTimeout, &db.LockBusyError{Holder: holder})
+		}
+		return nil, err
+	}
+	slog.Info("advisory lock acquired", "waited", time.Since(start).Round(time.Second).String())
+	return lock, nil
+}
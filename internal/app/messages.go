@@ -0,0 +1,183 @@
+package app
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/config"
+	"github.com/abriciof/rfcnpj-loader/internal/notify"
+	"github.com/abriciof/rfcnpj-loader/internal/redact"
+	"github.com/abriciof/rfcnpj-loader/internal/templates"
+)
+
+// messages renders notification subjects and bodies from the templates of
+// the configured locale (LOCALE, TEMPLATES_DIR). When an override fails to
+// render, the embedded template of the same locale is used instead.
+type messages struct {
+	set      *templates.Set
+	fallback *templates.Set
+}
+
+func newMessages(cfg config.Config) (*messages, error) {
+	set, err := templates.Load(cfg.Locale, cfg.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+	fallback := set
+	if cfg.TemplatesDir != "" {
+		if fallback, err = templates.Load(cfg.Locale, ""); err != nil {
+			return nil, err
+		}
+	}
+	return &messages{set: set, fallback: fallback}, nil
+}
+
+type keyValue struct {
+	Key   string
+	Value string
+}
+
+// messageView is the data given to the templates. Fields that don't apply
+// to a kind are left empty.
+type messageView struct {
+	Month           string
+	MonthHuman      string
+	HasMonth        bool
+	URL             string
+	Started         string
+	Finished        string
+	Duration        time.Duration
+	DurationRounded time.Duration
+	Downloaded      int
+	Extracted       int
+	Tables          []reportTableRow
+	Stages          []stageTiming
+	Reasons         []keyValue
+	Drift           []string
+	Warnings        []string
+
+	// started: tables to load and why
+	Load []keyValue
+	// up_to_date: every enabled table already has the month (vs. next month
+	// not published yet)
+	ByTable bool
+
+	// failed
+	Interrupted bool
+	Stage       string
+	Table       string
+	File        string
+	Error       string
+	Chain       []string
+}
+
+func (m *messages) view(rep report) messageView {
+	v := messageView{
+		URL:        formatMonthURLForEmail(rep.MonthURL),
+		Started:    formatTimeInOffset(rep.StartedAt, rep.UTCOffset).Format(time.RFC3339),
+		Downloaded: rep.Downloaded,
+		Extracted:  rep.Extracted,
+		Stages:     rep.Stages,
+		Warnings:   rep.Warnings,
+	}
+	if rep.Month.Year != 0 {
+		v.HasMonth = true
+		v.Month = rep.Month.String()
+		v.MonthHuman = rep.Month.Human(m.set.Locale)
+	}
+	if !rep.FinishedAt.IsZero() {
+		v.Finished = formatTimeInOffset(rep.FinishedAt, rep.UTCOffset).Format(time.RFC3339)
+		v.Duration = rep.FinishedAt.Sub(rep.StartedAt)
+		v.DurationRounded = v.Duration.Round(time.Second)
+	}
+
+	for k, rows := range rep.LoadedRows {
+		prev, ok := rep.PreviousRows[k]
+		v.Tables = append(v.Tables, reportTableRow{
+			Table:    k,
+			Rows:     rows,
+			HasPrev:  ok,
+			Previous: prev,
+			Delta:    formatDelta(rows - prev),
+			Reason:   rep.Reasons[k],
+		})
+	}
+	sort.Slice(v.Tables, func(i, j int) bool { return v.Tables[i].Table < v.Tables[j].Table })
+
+	for k, r := range rep.Reasons {
+		v.Reasons = append(v.Reasons, keyValue{Key: k, Value: r})
+	}
+	sort.Slice(v.Reasons, func(i, j int) bool { return v.Reasons[i].Key < v.Reasons[j].Key })
+
+	drift := append(rep.Drift[:0:0], rep.Drift...)
+	sort.Slice(drift, func(i, j int) bool { return drift[i].File < drift[j].File })
+	for _, d := range drift {
+		v.Drift = append(v.Drift, d.String())
+	}
+	return v
+}
+
+func (m *messages) started(rep report, plan monthPlan) (notify.Event, error) {
+	v := m.view(rep)
+	for t, ok := range plan.ShouldLoad {
+		if ok {
+			v.Load = append(v.Load, keyValue{Key: t, Value: plan.Reasons[t]})
+		}
+	}
+	sort.Slice(v.Load, func(i, j int) bool { return v.Load[i].Key < v.Load[j].Key })
+	return m.event(notify.KindStarted, v)
+}
+
+func (m *messages) upToDate(rep report, byTable bool) (notify.Event, error) {
+	v := m.view(rep)
+	v.ByTable = byTable
+	return m.event(notify.KindUpToDate, v)
+}
+
+func (m *messages) finished(rep report) (notify.Event, error) {
+	return m.event(notify.KindFinished, m.view(rep))
+}
+
+func (m *messages) failed(rep report, err error, interrupted bool) (notify.Event, error) {
+	fs := failureStage(&rep, err)
+	v := m.view(rep)
+	v.Interrupted = interrupted
+	v.Stage, v.Table, v.File = fs.Stage, fs.Table, fs.File
+	v.Error = redact.String(err.Error())
+	v.Chain = errorChain(err)
+	return m.event(notify.KindFailed, v)
+}
+
+func (m *messages) event(kind notify.Kind, v messageView) (notify.Event, error) {
+	ev, err := render(m.set, kind, v)
+	if err != nil && m.fallback != m.set {
+		slog.Warn("notification template failed; using the embedded one", "event", kind, "error", err)
+		ev, err = render(m.fallback, kind, v)
+	}
+	ev.Kind, ev.Month = kind, v.Month
+	return ev, err
+}
+
+func render(set *templates.Set, kind notify.Kind, v messageView) (notify.Event, error) {
+	var (
+		ev  notify.Event
+		err error
+	)
+	if ev.Subject, err = set.Subject(string(kind), v); err != nil {
+		return ev, err
+	}
+	if ev.Text, err = set.Text(string(kind), v); err != nil {
+		return ev, err
+	}
+	ev.HTML, _, err = set.HTML(string(kind), v)
+	return ev, err
+}
+
+// logRenderError reports a template error; the event is still sent with
+// whatever could be rendered.
+func logRenderError(kind notify.Kind, err error) {
+	if err != nil {
+		slog.Warn("could not render notification", "event", kind, "error", err)
+	}
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/config"
+	"github.com/abriciof/rfcnpj-loader/internal/db"
+	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+	"github.com/abriciof/rfcnpj-loader/internal/migrate"
+)
+
+// MigrateStatus prints the loader schema migrations and whether the target
+// database has them. It only reads, so it doesn't take the lock. It returns
+// an error when migrations are pending or unknown, so scripts can check it
+// before an upgrade.
+func MigrateStatus(ctx context.Context, cfg config.Config, w io.Writer) error {
+	sqlDB, err := db.OpenSQL(ctx, cfg.DBOptions())
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	rep, err := migrate.Check(ctx, sqlDB, cfg.TargetSchema)
+	if err != nil {
+		return err
+	}
+	writeMigrateStatus(w, rep)
+	switch {
+	case len(rep.Unknown) > 0:
+		return fmt.Errorf("o banco tem migrações desconhecidas %v: use uma versão mais nova do loader", rep.Unknown)
+	case rep.Pending() > 0:
+		return fmt.Errorf("%d migração(ões) pendente(s): rode \"migrate up\" ou uma carga", rep.Pending())
+	}
+	return nil
+}
+
+func writeMigrateStatus(w io.Writer, rep migrate.Report) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, m := range rep.Migrations {
+		status, at := "pending", ""
+		if m.Applied {
+			status, at = "applied", m.AppliedAt.Format(time.RFC3339)
+			if m.Modified {
+				status = "applied (modified)"
+			}
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", m.Version, m.Name, status, at)
+	}
+	for _, v := range rep.Unknown {
+		fmt.Fprintf(tw, "%04d\t?\tunknown\t\n", v)
+	}
+	tw.Flush()
+}
+
+// MigrateUp applies the pending migrations under the loader lock, like the
+// start of a run does.
+func MigrateUp(ctx context.Context, cfg config.Config) error {
+	sqlDB, err := db.OpenSQL(ctx, cfg.DBOptions())
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	lock, err := acquireRunLock(ctx, cfg, sqlDB)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	applied, err := migrateUp(ctx, cfg, sqlDB)
+	if err != nil {
+		return err
+	}
+	slog.Info("schema up to date", "applied", len(applied))
+	return nil
+}
+
+// migrateUp creates TARGET_SCHEMA, where the loader's own tables live, and
+// applies the pending migrations there.
+func migrateUp(ctx context.Context, cfg config.Config, sqlDB *sql.DB) ([]migrate.Migration, error) {
+	if cfg.TargetSchema != "" {
+		if _, err := sqlDB.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+loaders.QuoteIdent(cfg.TargetSchema)); err != nil {
+			return nil, fmt.Errorf("criar schema %s: %w", cfg.TargetSchema, err)
+		}
+	}
+	return migrate.Up(ctx, sqlDB, cfg.TargetSchema)
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/abriciof/rfcnpj-loader/internal/config"
+	"github.com/abriciof/rfcnpj-loader/internal/email"
+	"github.com/abriciof/rfcnpj-loader/internal/notify"
+	runreport "github.com/abriciof/rfcnpj-loader/internal/report"
+)
+
+// newNotifier builds the channels configured in cfg. A channel is enabled as
+// soon as its required settings are present.
+func newNotifier(cfg config.Config) (*notify.Multi, error) {
+	kinds, err := notify.ParseKinds(cfg.NotifyEvents)
+	if err != nil {
+		return nil, fmt.Errorf("NOTIFY_EVENTS inválido: %w", err)
+	}
+	switch cfg.MailAttachReport {
+	case "", "none", "json", "csv":
+	default:
+		return nil, fmt.Errorf("MAIL_ATTACH_REPORT inválido: %q (use none, json ou csv)", cfg.MailAttachReport)
+	}
+	n := &notify.Multi{Kinds: kinds}
+
+	smtpCfg := smtpConfig(cfg)
+	if email.Enabled(smtpCfg) {
+		n.Channels = append(n.Channels, &notify.SMTP{Config: smtpCfg})
+	}
+	if strings.TrimSpace(cfg.NotifyWebhookURL) != "" {
+		n.Channels = append(n.Channels, &notify.Webhook{URL: cfg.NotifyWebhookURL, Secret: cfg.NotifyWebhookSecret})
+	}
+	if strings.TrimSpace(cfg.NotifySlackURL) != "" {
+		n.Channels = append(n.Channels, &notify.Slack{URL: cfg.NotifySlackURL})
+	}
+	if strings.TrimSpace(cfg.TelegramBotToken) != "" && strings.TrimSpace(cfg.TelegramChatID) != "" {
+		n.Channels = append(n.Channels, &notify.Telegram{Token: cfg.TelegramBotToken, ChatID: cfg.TelegramChatID, APIURL: cfg.TelegramAPIURL})
+	}
+	return n, nil
+}
+
+func smtpConfig(cfg config.Config) email.SMTPConfig {
+	return email.SMTPConfig{
+		Host: cfg.SMTPHost,
+		Port: cfg.SMTPPort,
+		User: cfg.SMTPUser,
+		Pass: cfg.SMTPPass,
+		To:   cfg.MailTo,
+
+		TLS:      cfg.SMTPTLS,
+		Auth:     cfg.SMTPAuth,
+		From:     cfg.MailFrom,
+		FromName: cfg.MailFromName,
+		ReplyTo:  cfg.MailReplyTo,
+		Cc:       cfg.MailCc,
+		Bcc:      cfg.MailBcc,
+	}
+}
+
+// sendNotification never fails the run; channel errors are only logged.
+func sendNotification(ctx context.Context, n *notify.Multi, ev notify.Event) {
+	if err := n.Notify(ctx, ev); err != nil {
+		slog.Warn("notification failed", "event", ev.Kind, "error", err)
+	}
+}
+
+// attachReport adds the run report to ev: as JSON for the webhook and, with
+// MAIL_ATTACH_REPORT, as an e-mail attachment.
+func attachReport(cfg config.Config, rep *report, runErr error, ev *notify.Event) {
+	doc := rep.document(runErr)
+	b, err := doc.JSON()
+	if err != nil {
+		slog.Warn("could not encode run report", "error", err)
+		return
+	}
+	ev.Report = b
+
+	name := "rfcnpj-report"
+	if doc.Month != "" {
+		name += "-" + doc.Month
+	}
+	switch cfg.MailAttachReport {
+	case "json":
+		ev.Attachments = append(ev.Attachments, email.Attachment{Name: name + ".json", ContentType: "application/json", Data: b})
+	case "csv":
+		c, err := doc.CSV()
+		if err != nil {
+			slog.Warn("could not encode run report as csv", "error", err)
+			return
+		}
+		ev.Attachments = append(ev.Attachments, email.Attachment{Name: name + ".csv", ContentType: "text/csv; charset=utf-8", Data: c})
+	}
+}
+
+// writeRunReport stores the run report in REPORT_DIR; failures only warn.
+func writeRunReport(cfg config.Config, rep *report, runErr error) {
+	if strings.TrimSpace(cfg.ReportDir) == "" {
+		return
+	}
+	p, err := runreport.Write(cfg.ReportDir, rep.document(runErr))
+	if err != nil {
+		slog.Warn("could not write run report", "dir", cfg.ReportDir, "error", err)
+		return
+	}
+	slog.Info("run report written", "path", p, "status", rep.Status)
+}
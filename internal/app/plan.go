@@ -0,0 +1,131 @@
+package app
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/abriciof/rfcnpj-loader/internal/config"
+	"github.com/abriciof/rfcnpj-loader/internal/downloader"
+)
+
+// estimatedRatio is the assumed size of the extracted files of a zip not
+// downloaded yet, relative to the zip (the CSVs of the Receita compress about
+// this much). Zips already downloaded are measured.
+const estimatedRatio = 4
+
+// Plan prints what a run would do now: the target month, the tables that
+// would be dropped and reloaded, the zips to download and the disk they
+// need. Like the stage commands, it only reads the database and writes
+// nothing.
+func Plan(ctx context.Context, cfg config.Config, w io.Writer) (Outcome, error) {
+	plan, items, err := commandPlan(ctx, cfg)
+	if err != nil {
+		return Done, err
+	}
+	if items == nil {
+		if plan.Month.Year == 0 {
+			fmt.Fprintln(w, "Nenhuma tabela habilitada: nada a fazer.")
+		} else {
+			fmt.Fprintf(w, "Nada a carregar (mês %s): as tabelas habilitadas estão em dia.\n", plan.Month)
+		}
+		return UpToDate, nil
+	}
+
+	fmt.Fprintf(w, "Mês: %s (%s)\n\n", plan.Month, fmt.Sprintf(cfg.DavListURLTemplate, plan.Month.String()))
+
+	tasks := filterLoadTasks(buildLoadTasks(cfg, nil), plan.ShouldLoad)
+	fmt.Fprintln(w, "Tabelas recarregadas (a atual é trocada pela nova no fim da carga):")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tREASON")
+	for _, t := range tasks {
+		fmt.Fprintf(tw, "%s\t%s\n", t.spec.Ident(), plan.Reasons[t.spec.Name])
+	}
+	tw.Flush()
+	var kept []string
+	for _, t := range cfg.EnabledTables() {
+		if !plan.ShouldLoad[t] {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) > 0 {
+		sort.Strings(kept)
+		fmt.Fprintf(w, "Mantidas (já carregadas de %s): %s\n", plan.Month, strings.Join(kept, ", "))
+	}
+
+	down := downloader.NewDAVDownloader(cfg.DavBaseDomain, cfg.OutputFilesPath, cfg.DownloadWorkers, cfg.EnableDownload)
+	var (
+		download, total, extracted int64
+		pending, estimated         int
+	)
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ZIP\tTABLE\tSIZE\tSTATUS")
+	for _, it := range items {
+		name := filepath.Base(it.Href)
+		table, _ := downloader.TableForZip(name)
+		status := "baixar"
+		switch {
+		case !cfg.EnableDownload:
+			status = "ENABLE_DOWNLOAD=false"
+		case down.Current(it):
+			status = "já baixado"
+		default:
+			download += it.ContentLength
+			pending++
+		}
+		total += it.ContentLength
+		if n, ok := zipUncompressed(filepath.Join(cfg.OutputFilesPath, name)); ok && status != "baixar" {
+			extracted += n
+		} else {
+			extracted += it.ContentLength * estimatedRatio
+			estimated++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, table, formatBytes(it.ContentLength), status)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nDownload: %s em %d de %d zips\n", formatBytes(download), pending, len(items))
+	note := ""
+	if estimated > 0 {
+		note = fmt.Sprintf(" (estimativa de %dx o zip para %d zip(s) ainda não baixado(s))", estimatedRatio, estimated)
+	}
+	fmt.Fprintf(w, "Disco: %s de zips em %s e %s extraídos em %s%s\n",
+		formatBytes(total), cfg.OutputFilesPath, formatBytes(extracted), filepath.Join(cfg.ExtractedFilesPath, plan.Month.String()), note)
+	fmt.Fprintf(w, "Banco: até %s a mais durante a carga, com as tabelas novas ao lado das atuais até a troca\n", formatBytes(extracted))
+	return Done, nil
+}
+
+// zipUncompressed is the total uncompressed size of the entries of a local
+// zip.
+func zipUncompressed(path string) (int64, bool) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, false
+	}
+	defer r.Close()
+	var n int64
+	for _, f := range r.File {
+		n += int64(f.UncompressedSize64)
+	}
+	return n, true
+}
+
+// formatBytes shows n in the largest binary unit that keeps it above 1.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
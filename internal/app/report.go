@@ -0,0 +1,180 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+	"github.com/abriciof/rfcnpj-loader/internal/redact"
+	runreport "github.com/abriciof/rfcnpj-loader/internal/report"
+	"github.com/abriciof/rfcnpj-loader/internal/state"
+	"github.com/abriciof/rfcnpj-loader/internal/timeutil"
+)
+
+type report struct {
+	Month      timeutil.YearMonth
+	MonthURL   string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	UTCOffset  string
+	Downloaded int
+	Extracted  int
+	LoadedRows map[string]int64
+	Reasons    map[string]string
+	Warnings   []string
+	Drift      []*loaders.Drift
+	Errors     []string
+
+	// PreviousRows are the counts stored by the previous load of each table.
+	PreviousRows map[string]int64
+	// Stages are the completed stages, in order; Current is the running one.
+	Stages       []stageTiming
+	Current      string
+	currentStart time.Time
+
+	// Status is one of the report.Status* values; Files are the zips of the run.
+	Status string
+	Files  []runreport.File
+
+	BytesDownloaded int64
+	// skipped is set when LOCK_MODE=skip and another run held the lock
+	skipped bool
+	// history mirrors the stages to rfcnpj_run_stages once the database is up
+	history *runHistory
+}
+
+type stageTiming struct {
+	Name     string
+	Duration time.Duration
+	started  time.Time
+}
+
+// begin marks the start of a stage; if the run fails before end, Current is
+// the stage reported as failing.
+func (r *report) begin(stage string) {
+	r.Current = stage
+	r.currentStart = time.Now()
+	r.history.beginStage(stage, r.currentStart)
+}
+
+// end records the duration of the current stage as completed.
+func (r *report) end() {
+	if r.Current == "" {
+		return
+	}
+	now := time.Now()
+	r.Stages = append(r.Stages, stageTiming{Name: r.Current, Duration: now.Sub(r.currentStart).Round(time.Millisecond), started: r.currentStart})
+	r.history.endStage(r.Current, state.StageDone, now, "")
+	r.Current = ""
+}
+
+type reportTableRow struct {
+	Table    string
+	Rows     int64
+	HasPrev  bool
+	Previous int64
+	Delta    string
+	Reason   string
+}
+
+func formatDelta(d int64) string {
+	if d > 0 {
+		return fmt.Sprintf("+%d", d)
+	}
+	return fmt.Sprintf("%d", d)
+}
+
+func formatMonthURLForEmail(raw string) string {
+	const davPrefix = "https://arquivos.receitafederal.gov.br/public.php/dav/files/gn672Ad4CF8N6TK"
+	const webPrefix = "https://arquivos.receitafederal.gov.br/index.php/s/gn672Ad4CF8N6TK?dir="
+
+	if strings.HasPrefix(raw, davPrefix) {
+		path := strings.TrimPrefix(raw, davPrefix)
+		path = strings.TrimSuffix(path, "/")
+		return webPrefix + path
+	}
+	return raw
+}
+
+func formatTimeInOffset(t time.Time, offset string) time.Time {
+	offset = strings.TrimSpace(offset)
+	if offset == "" {
+		return t
+	}
+	parsed, err := time.Parse("-07:00", offset)
+	if err != nil {
+		return t
+	}
+	_, secs := parsed.Zone()
+	loc := time.FixedZone("UTC"+offset, secs)
+	return t.In(loc)
+}
+
+// settle sets the final status of a failed run and the end time. It can run
+// more than once.
+func (r *report) settle(ctx context.Context, err error) {
+	if err != nil {
+		r.Status = runreport.StatusFailed
+		// nem todo driver preserva context.Canceled na cadeia do erro
+		if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+			r.Status = runreport.StatusInterrupted
+		}
+	}
+	if r.FinishedAt.IsZero() {
+		r.FinishedAt = time.Now()
+	}
+}
+
+// document builds the public run report. err is the error that ended the run,
+// if any.
+func (r *report) document(err error) runreport.Report {
+	doc := runreport.Report{
+		SchemaVersion:   runreport.SchemaVersion,
+		Status:          r.Status,
+		MonthURL:        r.MonthURL,
+		StartedAt:       r.StartedAt,
+		FinishedAt:      r.FinishedAt,
+		DurationSeconds: r.FinishedAt.Sub(r.StartedAt).Seconds(),
+		Downloaded:      r.Downloaded,
+		Extracted:       r.Extracted,
+		Tables:          []runreport.Table{},
+		Files:           append([]runreport.File{}, r.Files...),
+		Stages:          make([]runreport.Stage, 0, len(r.Stages)),
+		Warnings:        append([]string(nil), r.Warnings...),
+	}
+	if r.Month.Year != 0 {
+		doc.Month = r.Month.String()
+	}
+
+	names := map[string]bool{}
+	for k := range r.LoadedRows {
+		names[k] = true
+	}
+	for k := range r.Reasons {
+		names[k] = true
+	}
+	for k := range names {
+		t := runreport.Table{Name: k, Rows: r.LoadedRows[k], Reason: r.Reasons[k]}
+		if prev, ok := r.PreviousRows[k]; ok {
+			t.PreviousRows = &prev
+		}
+		doc.Tables = append(doc.Tables, t)
+	}
+	sort.Slice(doc.Tables, func(i, j int) bool { return doc.Tables[i].Name < doc.Tables[j].Name })
+
+	for _, st := range r.Stages {
+		doc.Stages = append(doc.Stages, runreport.Stage{Name: st.Name, DurationSeconds: st.Duration.Seconds()})
+	}
+	for _, d := range r.Drift {
+		doc.Warnings = append(doc.Warnings, d.String())
+	}
+	if err != nil {
+		fs := failureStage(r, err)
+		doc.Error = &runreport.Error{Stage: fs.Stage, Table: fs.Table, File: fs.File, Message: redact.String(err.Error())}
+	}
+	return doc
+}
@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -16,28 +17,70 @@ import (
 	"github.com/abriciof/rfcnpj-loader/internal/dav"
 	"github.com/abriciof/rfcnpj-loader/internal/db"
 	"github.com/abriciof/rfcnpj-loader/internal/downloader"
-	"github.com/abriciof/rfcnpj-loader/internal/email"
 	"github.com/abriciof/rfcnpj-loader/internal/extract"
 	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+	"github.com/abriciof/rfcnpj-loader/internal/notify"
+	runreport "github.com/abriciof/rfcnpj-loader/internal/report"
 	"github.com/abriciof/rfcnpj-loader/internal/scan"
 	"github.com/abriciof/rfcnpj-loader/internal/state"
 	"github.com/abriciof/rfcnpj-loader/internal/timeutil"
 )
 
-type report struct {
-	Month      timeutil.YearMonth
-	MonthURL   string
-	StartedAt  time.Time
-	FinishedAt time.Time
-	UTCOffset  string
-	Downloaded int
-	Extracted  int
-	LoadedRows map[string]int64
-	Errors     []string
+// Outcome is what a run or command did, for the exit code of the CLI.
+type Outcome int
+
+const (
+	// Done means the month was loaded or the command did its work.
+	Done Outcome = iota
+	// UpToDate means there was nothing to do: nothing new was published, no
+	// table is enabled or, with LOCK_MODE=skip, another run held the lock.
+	UpToDate
+)
+
+// Run executes the pipeline once. When it fails (including cancellation by
+// SIGTERM) a "failed" notification is sent with the failing stage and how to
+// resume.
+func Run(ctx context.Context, cfg config.Config) (Outcome, error) {
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		return Done, err
+	}
+	msgs, err := newMessages(cfg)
+	if err != nil {
+		return Done, err
+	}
+	rep := &report{
+		StartedAt:  time.Now(),
+		UTCOffset:  cfg.ReportUTCOffset,
+		LoadedRows: map[string]int64{},
+		Reasons:    map[string]string{},
+
+		PreviousRows: map[string]int64{},
+	}
+
+	err = run(ctx, cfg, notifier, msgs, rep)
+	rep.settle(ctx, err)
+	if err != nil {
+		notifyFailure(ctx, cfg, notifier, msgs, rep, err)
+	}
+	if !rep.skipped {
+		writeRunReport(cfg, rep, err)
+	}
+	if err == nil && rep.Status != runreport.StatusLoaded {
+		return UpToDate, nil
+	}
+	return Done, err
 }
 
-func Run(ctx context.Context, cfg config.Config) error {
-	start := time.Now()
+// Load runs the pipeline on the zips already downloaded and extracted, as
+// ENABLE_DOWNLOAD=false and ENABLE_EXTRACT=false would.
+func Load(ctx context.Context, cfg config.Config) (Outcome, error) {
+	cfg.EnableDownload, cfg.EnableExtract = false, false
+	return Run(ctx, cfg)
+}
+
+func run(ctx context.Context, cfg config.Config, notifier *notify.Multi, msgs *messages, rep *report) (err error) {
+	start := rep.StartedAt
 	slog.Info("pipeline started",
 		"start_month", cfg.StartMonth,
 		"force_month", cfg.ForceMonth,
@@ -52,167 +95,328 @@ func Run(ctx context.Context, cfg config.Config) error {
 	_ = os.MkdirAll(cfg.OutputFilesPath, 0o755)
 	_ = os.MkdirAll(cfg.ExtractedFilesPath, 0o755)
 
-	sqlDB, err := db.OpenSQL(ctx, cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPass, cfg.DBName)
+	rep.begin("connect")
+	sqlDB, err := db.OpenSQL(ctx, cfg.DBOptions())
 	if err != nil {
 		return err
 	}
 	defer sqlDB.Close()
-	slog.Info("database connected", "host", cfg.DBHost, "port", cfg.DBPort, "db_name", cfg.DBName)
+	slog.Info("database connected", "target", cfg.DBOptions().Target())
+	rep.end()
+
+	// nada de DDL nem carga antes do lock: outra instância pode estar carregando
+	rep.begin("lock")
+	lock, err := acquireRunLock(ctx, cfg, sqlDB)
+	if errors.Is(err, errRunSkipped) {
+		slog.Info("run skipped", "reason", err.Error())
+		rep.skipped = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			slog.Warn("could not release advisory lock", "error", err)
+		}
+	}()
 
-	meta := state.NewMetaStore(sqlDB)
-	if err := meta.Ensure(ctx); err != nil {
+	if _, err := migrateUp(ctx, cfg, sqlDB); err != nil {
 		return err
 	}
+	meta := state.NewMetaStore(sqlDB, cfg.TargetSchema).WithTableNames(cfg.TablePrefix, cfg.TableSuffix)
+	rep.history = startHistory(ctx, state.NewRunStore(sqlDB, cfg.TargetSchema), cfg.RunTrigger, rep)
+	// runs before the lock release and sqlDB.Close
+	defer func() {
+		rep.settle(ctx, err)
+		rep.history.finish(rep, err)
+	}()
+	rep.end()
 
-	enabledTables := enabledTableNames(cfg)
+	enabledTables := cfg.EnabledTables()
 	if len(enabledTables) == 0 {
 		slog.Warn("no tables enabled; nothing to do")
 		return nil
 	}
 
-	res, items, tableShouldLoad, err := resolveTargetMonth(ctx, cfg, meta, enabledTables)
+	rep.begin("list")
+	plan, err := resolveTargetMonth(ctx, cfg, meta, enabledTables)
 	if err != nil {
 		return err
 	}
+	res, items, tableShouldLoad := plan.Month, plan.Items, plan.ShouldLoad
 
-	rep := report{
-		Month:      res,
-		MonthURL:   fmt.Sprintf(cfg.DavListURLTemplate, res.String()),
-		StartedAt:  start,
-		UTCOffset:  cfg.ReportUTCOffset,
-		LoadedRows: map[string]int64{},
-	}
+	rep.Month = res
+	rep.MonthURL = fmt.Sprintf(cfg.DavListURLTemplate, res.String())
+	rep.history.setMonth(res.String())
+	rep.end()
 
 	if items == nil {
 		// up-to-date
-		msg := fmt.Sprintf("✅ Já atualizado. Próximo mês (%s) ainda não disponível.", res.HumanPTBR())
-		slog.Info("up-to-date", "month", res.String(), "message", msg)
+		rep.Status, rep.FinishedAt = runreport.StatusUpToDate, time.Now()
+		ev, err := msgs.upToDate(*rep, false)
+		logRenderError(ev.Kind, err)
+		slog.Info("up-to-date", "month", res.String(), "message", ev.Text)
 
-		if cfg.MailNotifyUpToDate && email.Enabled(email.SMTPConfig{Host: cfg.SMTPHost, Port: cfg.SMTPPort, User: cfg.SMTPUser, Pass: cfg.SMTPPass, To: cfg.MailTo}) {
-			_ = email.Send(email.SMTPConfig{Host: cfg.SMTPHost, Port: cfg.SMTPPort, User: cfg.SMTPUser, Pass: cfg.SMTPPass, To: cfg.MailTo},
-				"RFCNPJ Loader - Atualizado ("+res.String()+")",
-				msg,
-			)
-		}
+		attachReport(cfg, rep, nil, &ev)
+		sendNotification(ctx, notifier, ev)
 		return nil
 	}
 	slog.Info("remote files listed", "month", res.String(), "count", len(items))
 
 	if !hasAnyTableToLoad(tableShouldLoad) {
-		msg := fmt.Sprintf("✅ Já atualizado para o mês %s em todas as tabelas habilitadas.", res.HumanPTBR())
-		slog.Info("up-to-date-by-table", "month", res.String(), "message", msg)
+		rep.Status, rep.FinishedAt = runreport.StatusUpToDate, time.Now()
+		ev, err := msgs.upToDate(*rep, true)
+		logRenderError(ev.Kind, err)
+		slog.Info("up-to-date-by-table", "month", res.String(), "message", ev.Text)
 
-		if cfg.MailNotifyUpToDate && email.Enabled(email.SMTPConfig{Host: cfg.SMTPHost, Port: cfg.SMTPPort, User: cfg.SMTPUser, Pass: cfg.SMTPPass, To: cfg.MailTo}) {
-			_ = email.Send(email.SMTPConfig{Host: cfg.SMTPHost, Port: cfg.SMTPPort, User: cfg.SMTPUser, Pass: cfg.SMTPPass, To: cfg.MailTo},
-				"RFCNPJ Loader - Atualizado ("+res.String()+")",
-				msg,
-			)
-		}
+		attachReport(cfg, rep, nil, &ev)
+		sendNotification(ctx, notifier, ev)
 		return nil
 	}
 
 	// Filter wanted zips based on enabled tables
-	want := wantedFromTableMap(tableShouldLoad)
+	want := downloader.Wanted(tableShouldLoad)
 	wantedItems := downloader.FilterWanted(items, want)
 	rep.Downloaded = len(wantedItems)
+	for _, it := range wantedItems {
+		name := filepath.Base(it.Href)
+		table, _ := downloader.TableForZip(name)
+		rep.Files = append(rep.Files, runreport.File{
+			Name:         name,
+			Table:        table,
+			URL:          strings.TrimRight(cfg.DavBaseDomain, "/") + it.Href,
+			Size:         it.ContentLength,
+			LastModified: it.LastModified,
+		})
+	}
 	slog.Info("filtered wanted zip files", "count", len(wantedItems))
 
+	ev, err := msgs.started(*rep, plan)
+	logRenderError(ev.Kind, err)
+	sendNotification(ctx, notifier, ev)
+
 	// Download (equivalente ao bloco comentado do Python, controlado por ENABLE_DOWNLOAD)
-	down := downloader.NewDAVDownloader(cfg.DavBaseDomain, cfg.OutputFilesPath, cfg.DownloadWorkers, cfg.EnableDownload)
-	if err := down.DownloadAll(ctx, wantedItems); err != nil {
+	rep.begin("download")
+	rep.BytesDownloaded, err = downloadZips(ctx, cfg, wantedItems)
+	if err != nil {
 		return err
 	}
+	rep.end()
 	slog.Info("download stage finished", "planned_files", len(wantedItems), "enabled", cfg.EnableDownload)
 
 	// Extract (equivalente ao bloco comentado do Python, controlado por ENABLE_EXTRACT)
-	zipPaths := make([]string, 0, len(wantedItems))
-	for _, it := range wantedItems {
-		zipPaths = append(zipPaths, filepath.Join(cfg.OutputFilesPath, filepath.Base(it.Href)))
-	}
-	extractedMonthDir := filepath.Join(cfg.ExtractedFilesPath, res.String())
-	ext := extract.NewExtractor(cfg.ExtractWorkers, cfg.EnableExtract)
-	if err := ext.ExtractAll(ctx, zipPaths, extractedMonthDir); err != nil {
+	rep.begin("extract")
+	extractedMonthDir, err := extractZips(ctx, cfg, res, wantedItems)
+	if err != nil {
 		return err
 	}
-	rep.Extracted = len(zipPaths)
-	slog.Info("extract stage finished", "planned_files", len(zipPaths), "enabled", cfg.EnableExtract, "dest_dir", extractedMonthDir)
+	rep.Extracted = len(wantedItems)
+	rep.end()
+	slog.Info("extract stage finished", "planned_files", len(wantedItems), "enabled", cfg.EnableExtract, "dest_dir", extractedMonthDir)
 
 	// Scan extracted directory for CSV/TXT files
-	filesByType, err := scan.ScanExtracted(extractedMonthDir)
+	rep.begin("scan")
+	filesByType, err := scanMonth(cfg, extractedMonthDir, res, tableShouldLoad, rep)
 	if err != nil {
 		return err
 	}
-	slog.Info("scan stage finished",
-		"empresa_files", len(filesByType.Empresa),
-		"estabelecimento_files", len(filesByType.Estabelecimento),
-		"socios_files", len(filesByType.Socios),
-		"simples_files", len(filesByType.Simples),
-		"cnae_files", len(filesByType.Cnae),
-		"moti_files", len(filesByType.Moti),
-		"munic_files", len(filesByType.Munic),
-		"natju_files", len(filesByType.Natju),
-		"pais_files", len(filesByType.Pais),
-		"quals_files", len(filesByType.Quals),
-	)
+	rep.end()
+	scanAttrs := make([]any, 0, 2*len(cfg.Tables))
+	for _, t := range cfg.Tables {
+		scanAttrs = append(scanAttrs, t.Name+"_files", len(filesByType[t.Name]))
+	}
+	slog.Info("scan stage finished", scanAttrs...)
 
 	// Load enabled tables in parallel (TABLE_WORKERS)
 	tasks := buildLoadTasks(cfg, filesByType)
 	tasks = filterLoadTasks(tasks, tableShouldLoad)
+	rep.begin("load")
+	for _, task := range tasks {
+		rep.Reasons[task.spec.Name] = plan.Reasons[task.spec.Name]
+		slog.Info("table scheduled for load", "table", task.spec.Name, "reason", plan.Reasons[task.spec.Name])
+
+		// contagem da carga anterior, para a diferença no relatório
+		prev, ok, err := meta.LoadedRows(ctx, task.spec.Name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			rep.PreviousRows[task.spec.Name] = prev
+		}
+	}
+	// as tabelas em uso só mudam no swap; até lá a carga vai para <tabela>__new
+	defer func() {
+		if err != nil {
+			dropStaging(ctx, sqlDB, tasks)
+		}
+	}()
 	if len(tasks) == 0 {
 		slog.Info("all enabled tables already loaded for target month", "month", res.String())
-	} else if err := runLoadTasks(ctx, sqlDB, cfg, tasks, &rep); err != nil {
+	} else if err := runLoadTasks(ctx, sqlDB, cfg, tasks, rep); err != nil {
 		return err
 	}
+	rep.end()
 	slog.Info("load stage finished", "tables", len(tasks))
 
 	// Optional indexes (equivalente ao bloco comentado do Python)
 	if cfg.CreateIndexes {
-		if err := createIndexes(ctx, sqlDB, cfg); err != nil {
+		rep.begin("index")
+		if err := createIndexes(ctx, sqlDB, cfg, tasks); err != nil {
 			return err
 		}
+		rep.end()
 		slog.Info("index stage finished")
 	}
 
-	// Save meta month + url
-	_ = meta.Set(ctx, "loaded_month", res.String())
-	_ = meta.Set(ctx, "loaded_url", rep.MonthURL)
-	for _, task := range tasks {
-		_ = meta.Set(ctx, tableMonthMetaKey(task.spec.Name), res.String())
-		_ = meta.Set(ctx, tableURLMetaKey(task.spec.Name), rep.MonthURL)
+	rep.begin("swap")
+	if err := swapAndRecord(ctx, meta, res, items, tasks, rep); err != nil {
+		return err
 	}
+	rep.end()
+	slog.Info("new tables swapped in", "month", res.String(), "tables", len(tasks))
 
-	rep.FinishedAt = time.Now()
+	rep.Status, rep.FinishedAt = runreport.StatusLoaded, time.Now()
 
-	// Email notify
-	if email.Enabled(email.SMTPConfig{Host: cfg.SMTPHost, Port: cfg.SMTPPort, User: cfg.SMTPUser, Pass: cfg.SMTPPass, To: cfg.MailTo}) {
-		subject := fmt.Sprintf("RFCNPJ Loader finalizado - %s", res.String())
-		body := formatReport(rep)
-		_ = email.Send(email.SMTPConfig{Host: cfg.SMTPHost, Port: cfg.SMTPPort, User: cfg.SMTPUser, Pass: cfg.SMTPPass, To: cfg.MailTo}, subject, body)
-	}
+	// Notify
+	ev, err = msgs.finished(*rep)
+	logRenderError(ev.Kind, err)
+	attachReport(cfg, rep, nil, &ev)
+	sendNotification(ctx, notifier, ev)
 
 	slog.Info("pipeline finished", "month", res.String(), "duration", time.Since(start).String())
 	return nil
 }
 
-func resolveTargetMonth(ctx context.Context, cfg config.Config, meta *state.MetaStore, enabledTables []string) (timeutil.YearMonth, []dav.Item, map[string]bool, error) {
+// downloadZips downloads items to OUTPUT_FILES_PATH; with ENABLE_DOWNLOAD=false
+// it only logs what it would do. It returns the bytes downloaded.
+func downloadZips(ctx context.Context, cfg config.Config, items []dav.Item) (int64, error) {
+	down := downloader.NewDAVDownloader(cfg.DavBaseDomain, cfg.OutputFilesPath, cfg.DownloadWorkers, cfg.EnableDownload)
+	err := down.DownloadAll(ctx, items)
+	return down.BytesDownloaded(), err
+}
+
+// extractZips extracts the downloaded zips of items into
+// EXTRACTED_FILES_PATH/<month> and returns that directory.
+func extractZips(ctx context.Context, cfg config.Config, month timeutil.YearMonth, items []dav.Item) (string, error) {
+	zipPaths := make([]string, 0, len(items))
+	for _, it := range items {
+		zipPaths = append(zipPaths, filepath.Join(cfg.OutputFilesPath, filepath.Base(it.Href)))
+	}
+	dir := filepath.Join(cfg.ExtractedFilesPath, month.String())
+	ext := extract.NewExtractor(cfg.ExtractWorkers, cfg.EnableExtract)
+	if cfg.ExtractMaxEntryBytes > 0 {
+		ext.Limits.MaxEntryBytes = cfg.ExtractMaxEntryBytes
+	}
+	if cfg.ExtractMaxTotalBytes > 0 {
+		ext.Limits.MaxTotalBytes = cfg.ExtractMaxTotalBytes
+	}
+	if cfg.ExtractMaxRatio > 0 {
+		ext.Limits.MaxRatio = cfg.ExtractMaxRatio
+	}
+	return dir, ext.ExtractAll(ctx, zipPaths, dir)
+}
+
+// scanMonth ties the files extracted to dir to their tables and confirms by
+// the content the tables of shouldLoad. Ignored files and corrections go to
+// rep.Warnings. A table of shouldLoad left without files fails the run: it
+// would keep the data of the previous month with the meta of this one.
+func scanMonth(cfg config.Config, dir string, month timeutil.YearMonth, shouldLoad map[string]bool, rep *report) (scan.FilesByType, error) {
+	scanned, err := scan.Scan(dir, month.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(scanned.Unclassified) > 0 {
+		if cfg.ScanUnclassified == "fail" {
+			return nil, fmt.Errorf("arquivos extraídos sem tabela definida (SCAN_UNCLASSIFIED=fail): %s", strings.Join(scanned.Unclassified, ", "))
+		}
+		slog.Warn("unclassified extracted files ignored", "files", scanned.Unclassified)
+		rep.Warnings = append(rep.Warnings, "arquivos ignorados sem tabela definida: "+strings.Join(scanned.Unclassified, ", "))
+	}
+
+	// Confirma pelo conteúdo a tabela de cada arquivo antes de qualquer DROP
+	detections, err := scan.Verify(&scanned, loaders.All, shouldLoad)
+	if err != nil {
+		return nil, err
+	}
+	var mismatches []string
+	for _, d := range detections {
+		switch d.Status {
+		case scan.SniffCorrected:
+			slog.Warn("file table corrected by content", "file", d.File, "from", d.Chosen, "to", d.Table)
+			rep.Warnings = append(rep.Warnings, d.String())
+		case scan.SniffMismatch:
+			slog.Warn("file content does not match its table", "file", d.File, "table", d.Chosen, "fields", d.Fields, "compatible", d.Compatible)
+			mismatches = append(mismatches, d.String())
+		case scan.SniffEmpty:
+			slog.Debug("empty file; content check skipped", "file", d.File, "table", d.Chosen)
+		}
+	}
+	if len(mismatches) > 0 {
+		if cfg.SniffMismatch != "warn" {
+			return nil, fmt.Errorf("layout dos arquivos não confere com a tabela (SNIFF_MISMATCH=%s):\n%s", cfg.SniffMismatch, strings.Join(mismatches, "\n"))
+		}
+		rep.Warnings = append(rep.Warnings, mismatches...)
+	}
+
+	if err := scan.WriteLineage(dir, scanned.Lineage); err != nil {
+		slog.Warn("could not write lineage manifest", "error", err)
+	}
+	if missing := tablesWithoutFiles(shouldLoad, scanned.Files); len(missing) > 0 {
+		return nil, fmt.Errorf("nenhum arquivo de %s em %s: sem eles as tabelas ficariam com os dados do mês anterior", strings.Join(missing, ", "), dir)
+	}
+	return scanned.Files, nil
+}
+
+// tablesWithoutFiles lists, sorted, the tables of shouldLoad that have no file.
+func tablesWithoutFiles(shouldLoad map[string]bool, files scan.FilesByType) []string {
+	var out []string
+	for table, load := range shouldLoad {
+		if load && len(files[table]) == 0 {
+			out = append(out, table)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// monthPlan is what resolveTargetMonth decided to do. Items is nil when there
+// is nothing to load (next month not published and no republished files).
+type monthPlan struct {
+	Month      timeutil.YearMonth
+	Items      []dav.Item
+	ShouldLoad map[string]bool
+	Reasons    map[string]string
+}
+
+// resolveTargetMonth decides the month to load and the tables to load from
+// it. meta is nil when the loader schema was never migrated: then no table
+// was loaded yet and all of them start at START_MONTH.
+func resolveTargetMonth(ctx context.Context, cfg config.Config, meta *state.MetaStore, enabledTables []string) (monthPlan, error) {
 	client := dav.NewClient()
 
 	// FORCE_MONTH
 	if strings.TrimSpace(cfg.ForceMonth) != "" {
 		ym, err := timeutil.ParseYearMonth(cfg.ForceMonth)
 		if err != nil {
-			return timeutil.YearMonth{}, nil, nil, fmt.Errorf("FORCE_MONTH inválido: %w", err)
+			return monthPlan{}, fmt.Errorf("FORCE_MONTH inválido: %w", err)
 		}
 		url := fmt.Sprintf(cfg.DavListURLTemplate, ym.String())
 		items, err := client.ListZips(ctx, url)
 		if err != nil {
-			return ym, nil, nil, fmt.Errorf("FORCE_MONTH não disponível: %w", err)
+			return monthPlan{Month: ym}, fmt.Errorf("FORCE_MONTH não disponível: %w", err)
+		}
+		plan := monthPlan{
+			Month:      ym,
+			Items:      items,
+			ShouldLoad: make(map[string]bool, len(enabledTables)),
+			Reasons:    make(map[string]string, len(enabledTables)),
 		}
-		shouldLoad := make(map[string]bool, len(enabledTables))
 		for _, tbl := range enabledTables {
-			shouldLoad[tbl] = true
+			plan.ShouldLoad[tbl] = true
+			plan.Reasons[tbl] = "FORCE_MONTH=" + ym.String()
 		}
-		return ym, items, shouldLoad, nil
+		return plan, nil
 	}
 
 	var (
@@ -223,27 +427,29 @@ func resolveTargetMonth(ctx context.Context, cfg config.Config, meta *state.Meta
 	)
 
 	for _, table := range enabledTables {
-		lastStr, ok, err := meta.Get(ctx, tableMonthMetaKey(table))
-		if err != nil {
-			return timeutil.YearMonth{}, nil, nil, err
+		var (
+			last timeutil.YearMonth
+			ok   bool
+		)
+		if meta != nil {
+			var err error
+			if last, ok, err = meta.LoadedMonth(ctx, table); err != nil {
+				return monthPlan{}, err
+			}
 		}
 
 		var candidate timeutil.YearMonth
 		if ok {
-			last, err := timeutil.ParseYearMonth(lastStr)
-			if err != nil {
-				return timeutil.YearMonth{}, nil, nil, fmt.Errorf("meta inválida para %s: %w", table, err)
-			}
 			lastByTable[table] = last
 			hasByTable[table] = true
 			candidate = last.Next()
 		} else {
 			if strings.TrimSpace(cfg.StartMonth) == "" {
-				return timeutil.YearMonth{}, nil, nil, fmt.Errorf("primeira execução da tabela %s: START_MONTH é obrigatório", table)
+				return monthPlan{}, fmt.Errorf("primeira execução da tabela %s: START_MONTH é obrigatório", table)
 			}
 			first, err := timeutil.ParseYearMonth(cfg.StartMonth)
 			if err != nil {
-				return timeutil.YearMonth{}, nil, nil, fmt.Errorf("START_MONTH inválido: %w", err)
+				return monthPlan{}, fmt.Errorf("START_MONTH inválido: %w", err)
 			}
 			candidate = first
 		}
@@ -257,57 +463,131 @@ func resolveTargetMonth(ctx context.Context, cfg config.Config, meta *state.Meta
 	url := fmt.Sprintf(cfg.DavListURLTemplate, target.String())
 	items, err := client.ListZips(ctx, url)
 	if err != nil {
-		// mês ainda não publicado -> up-to-date
-		return target, nil, nil, nil
+		// mês ainda não publicado -> confere se o mês atual foi republicado
+		return resolveRepublished(ctx, cfg, meta, client, target, enabledTables, lastByTable)
 	}
 
-	shouldLoad := make(map[string]bool, len(enabledTables))
+	plan := monthPlan{
+		Month:      target,
+		Items:      items,
+		ShouldLoad: make(map[string]bool, len(enabledTables)),
+		Reasons:    make(map[string]string, len(enabledTables)),
+	}
+	var current []string
 	for _, table := range enabledTables {
-		if !hasByTable[table] {
-			shouldLoad[table] = true
-			continue
+		switch {
+		case !hasByTable[table]:
+			plan.ShouldLoad[table] = true
+			plan.Reasons[table] = "primeira carga (START_MONTH=" + target.String() + ")"
+		case lastByTable[table].String() != target.String():
+			plan.ShouldLoad[table] = true
+			plan.Reasons[table] = "novo mês (anterior " + lastByTable[table].String() + ")"
+		default:
+			current = append(current, table)
 		}
-		shouldLoad[table] = lastByTable[table].String() != target.String()
 	}
-	return target, items, shouldLoad, nil
-}
 
-type loadTask struct {
-	spec  loaders.TableSpec
-	files []string
+	republished, err := republishedTables(ctx, meta, current, items)
+	if err != nil {
+		return monthPlan{}, err
+	}
+	for table, reason := range republished {
+		plan.ShouldLoad[table] = true
+		plan.Reasons[table] = reason
+	}
+	return plan, nil
 }
 
-func buildLoadTasks(cfg config.Config, fb scan.FilesByType) []loadTask {
-	var tasks []loadTask
-	if cfg.LoadEmpresa {
-		tasks = append(tasks, loadTask{spec: loaders.Empresa, files: fb.Empresa})
-	}
-	if cfg.LoadEstabelecimento {
-		tasks = append(tasks, loadTask{spec: loaders.Estabelecimento, files: fb.Estabelecimento})
+// resolveRepublished is used when the next month is not published yet. It
+// lists the month before target and reloads the tables loaded from it whose
+// source zips changed since they were loaded.
+func resolveRepublished(ctx context.Context, cfg config.Config, meta *state.MetaStore, client *dav.Client, target timeutil.YearMonth, enabledTables []string, lastByTable map[string]timeutil.YearMonth) (monthPlan, error) {
+	cur := target.Prev()
+	var tables []string
+	for _, table := range enabledTables {
+		if last, ok := lastByTable[table]; ok && last.String() == cur.String() {
+			tables = append(tables, table)
+		}
 	}
-	if cfg.LoadSocios {
-		tasks = append(tasks, loadTask{spec: loaders.Socios, files: fb.Socios})
+	if len(tables) == 0 {
+		return monthPlan{Month: target}, nil
 	}
-	if cfg.LoadSimples {
-		tasks = append(tasks, loadTask{spec: loaders.Simples, files: fb.Simples})
+
+	url := fmt.Sprintf(cfg.DavListURLTemplate, cur.String())
+	items, err := client.ListZips(ctx, url)
+	if err != nil {
+		slog.Warn("could not list current month to check for republished files", "month", cur.String(), "error", err)
+		return monthPlan{Month: target}, nil
 	}
-	if cfg.LoadCnae {
-		tasks = append(tasks, loadTask{spec: loaders.Cnae, files: fb.Cnae})
+
+	republished, err := republishedTables(ctx, meta, tables, items)
+	if err != nil {
+		return monthPlan{}, err
 	}
-	if cfg.LoadMoti {
-		tasks = append(tasks, loadTask{spec: loaders.Moti, files: fb.Moti})
+	if len(republished) == 0 {
+		return monthPlan{Month: target}, nil
 	}
-	if cfg.LoadMunic {
-		tasks = append(tasks, loadTask{spec: loaders.Munic, files: fb.Munic})
+
+	plan := monthPlan{
+		Month:      cur,
+		Items:      items,
+		ShouldLoad: make(map[string]bool, len(enabledTables)),
+		Reasons:    republished,
 	}
-	if cfg.LoadNatju {
-		tasks = append(tasks, loadTask{spec: loaders.Natju, files: fb.Natju})
+	for _, table := range enabledTables {
+		plan.ShouldLoad[table] = republished[table] != ""
 	}
-	if cfg.LoadPais {
-		tasks = append(tasks, loadTask{spec: loaders.Pais, files: fb.Pais})
+	return plan, nil
+}
+
+// republishedTables compares the stored manifest of each table with the
+// current listing and returns the reload reason of the tables that changed.
+// Tables without a stored manifest (loaded by older versions) are left alone.
+func republishedTables(ctx context.Context, meta *state.MetaStore, tables []string, items []dav.Item) (map[string]string, error) {
+	out := map[string]string{}
+	for _, table := range tables {
+		stored, ok, err := meta.LoadedManifest(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			slog.Debug("no stored manifest; skipping republish check", "table", table)
+			continue
+		}
+
+		changes := stored.Changes(tableManifest(items, table))
+		if len(changes) == 0 {
+			continue
+		}
+		slog.Info("republished files detected", "table", table, "changes", changes)
+		out[table] = "arquivos republicados: " + strings.Join(changes, "; ")
 	}
-	if cfg.LoadQuals {
-		tasks = append(tasks, loadTask{spec: loaders.Quals, files: fb.Quals})
+	return out, nil
+}
+
+func tableManifest(items []dav.Item, table string) state.Manifest {
+	return state.NewManifest(downloader.FilterWanted(items, downloader.Wanted{table: true}))
+}
+
+type loadTask struct {
+	spec  loaders.TableSpec
+	files []string
+	// filter and fileWorkers come from the table config
+	filter      map[string][]string
+	fileWorkers int
+}
+
+func buildLoadTasks(cfg config.Config, fb scan.FilesByType) []loadTask {
+	var tasks []loadTask
+	for _, t := range cfg.Tables {
+		if !t.Enabled {
+			continue
+		}
+		workers := cfg.FileWorkers
+		if t.FileWorkers > 0 {
+			workers = t.FileWorkers
+		}
+		tasks = append(tasks, loadTask{spec: t.Spec(), files: fb[t.Name], filter: t.Filter, fileWorkers: workers})
 	}
 
 	// keep stable order
@@ -346,14 +626,14 @@ func runLoadTasks(ctx context.Context, sqlDB *sql.DB, cfg config.Config, tasks [
 				return
 			}
 
-			// drop+create table once
-			if err := loaders.EnsureTable(ctx, sqlDB, t.spec, true); err != nil {
-				errCh <- err
+			// drop+create the staging table once
+			if err := loaders.EnsureTable(ctx, sqlDB, t.spec.Staging(), true); err != nil {
+				errCh <- &StageError{Stage: "load", Table: t.spec.Name, Err: err}
 				return
 			}
 
 			// file-level parallelism
-			fileSem := make(chan struct{}, cfg.FileWorkers)
+			fileSem := make(chan struct{}, max(t.fileWorkers, 1))
 			var wgf sync.WaitGroup
 			localErr := make(chan error, len(t.files))
 
@@ -365,13 +645,20 @@ func runLoadTasks(ctx context.Context, sqlDB *sql.DB, cfg config.Config, tasks [
 					fileSem <- struct{}{}
 					defer func() { <-fileSem }()
 
-					r, err := loaders.CopyCSV(ctx, sqlDB, t.spec, fp)
+					r, err := loaders.CopyCSV(ctx, sqlDB, t.spec.Staging(), fp, loaders.CopyOptions{DriftPolicy: loaders.DriftPolicy(cfg.LayoutDrift), Filter: t.filter})
 					if err != nil {
-						localErr <- err
+						localErr <- &StageError{Stage: "load", Table: t.spec.Name, File: fp, Err: err}
 						return
 					}
+					if r.Drift != nil {
+						r.Drift.Table = t.spec.Name
+						slog.Warn("layout drift detected", "table", t.spec.Name, "file", fp, "expected", r.Drift.Expected, "observed", r.Drift.Observed)
+					}
 					mu.Lock()
 					rep.LoadedRows[t.spec.Name] += r.Rows
+					if r.Drift != nil {
+						rep.Drift = append(rep.Drift, r.Drift)
+					}
 					mu.Unlock()
 				}()
 			}
@@ -384,6 +671,10 @@ func runLoadTasks(ctx context.Context, sqlDB *sql.DB, cfg config.Config, tasks [
 					return
 				}
 			}
+
+			if err := loaders.ConvertColumns(ctx, sqlDB, t.spec.Staging()); err != nil {
+				errCh <- &StageError{Stage: "load", Table: t.spec.Name, Err: err}
+			}
 		}()
 	}
 
@@ -397,90 +688,76 @@ func runLoadTasks(ctx context.Context, sqlDB *sql.DB, cfg config.Config, tasks [
 	return nil
 }
 
-func createIndexes(ctx context.Context, sqlDB *sql.DB, cfg config.Config) error {
-	// equivalente ao bloco comentado do Python
-	stmts := []string{}
-	if cfg.LoadEmpresa {
-		stmts = append(stmts, `CREATE INDEX IF NOT EXISTS empresa_cnpj ON empresa(cnpj_basico);`)
-	}
-	if cfg.LoadEstabelecimento {
-		stmts = append(stmts, `CREATE INDEX IF NOT EXISTS estabelecimento_cnpj ON estabelecimento(cnpj_basico);`)
-	}
-	if cfg.LoadSocios {
-		stmts = append(stmts, `CREATE INDEX IF NOT EXISTS socios_cnpj ON socios(cnpj_basico);`)
-	}
-	if cfg.LoadSimples {
-		stmts = append(stmts, `CREATE INDEX IF NOT EXISTS simples_cnpj ON simples(cnpj_basico);`)
+// createIndexes indexes the staging tables of this run, so the indexes are
+// ready when they are swapped in, and the enabled tables not reloaded in place.
+func createIndexes(ctx context.Context, sqlDB *sql.DB, cfg config.Config, tasks []loadTask) error {
+	staged := map[string]bool{}
+	for _, t := range tasks {
+		staged[t.spec.Name] = len(t.files) > 0
 	}
-	for _, s := range stmts {
-		if _, err := sqlDB.ExecContext(ctx, s); err != nil {
-			return err
+	for _, t := range cfg.Tables {
+		if !t.Enabled {
+			continue
+		}
+		spec := t.Spec()
+		if staged[t.Name] {
+			spec = spec.Staging()
+		}
+		if err := loaders.CreateIndexes(ctx, sqlDB, spec); err != nil {
+			return &StageError{Stage: "index", Table: t.Name, Err: err}
 		}
 	}
 	return nil
 }
 
-func formatReport(rep report) string {
-	dur := rep.FinishedAt.Sub(rep.StartedAt)
-	sb := strings.Builder{}
-	sb.WriteString("RFCNPJ Loader - Finalizado\n")
-	sb.WriteString("Mês: " + rep.Month.HumanPTBR() + " (" + rep.Month.String() + ")\n")
-	sb.WriteString("URL: " + formatMonthURLForEmail(rep.MonthURL) + "\n")
-	sb.WriteString("Início: " + formatTimeInOffset(rep.StartedAt, rep.UTCOffset).Format(time.RFC3339) + "\n")
-	sb.WriteString("Fim: " + formatTimeInOffset(rep.FinishedAt, rep.UTCOffset).Format(time.RFC3339) + "\n")
-	sb.WriteString(fmt.Sprintf("Duração: %s\n", dur))
-	sb.WriteString(fmt.Sprintf("Downloads planejados: %d\n", rep.Downloaded))
-	sb.WriteString(fmt.Sprintf("Arquivos extraídos: %d\n", rep.Extracted))
-	sb.WriteString("\nLinhas carregadas por tabela:\n")
-	keys := make([]string, 0, len(rep.LoadedRows))
-	for k := range rep.LoadedRows {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		sb.WriteString(fmt.Sprintf("- %s: %d\n", k, rep.LoadedRows[k]))
-	}
-	return sb.String()
+// swapAndRecord replaces the live tables by the staging ones and records the
+// load in rfcnpj_meta, in one transaction: a table is never switched without
+// its meta, nor the reverse. scanMonth fails a run with a table to load and
+// no files; should one get here anyway, it keeps its data and its meta, and
+// the month isn't recorded as loaded.
+func swapAndRecord(ctx context.Context, meta *state.MetaStore, month timeutil.YearMonth, items []dav.Item, tasks []loadTask, rep *report) error {
+	return meta.Update(ctx, func(tx *state.MetaTx) error {
+		complete := true
+		for _, t := range tasks {
+			if len(t.files) == 0 {
+				slog.Warn("table without files not recorded as loaded", "table", t.spec.Name, "month", month.String())
+				complete = false
+				continue
+			}
+			if err := loaders.SwapStaging(ctx, tx.Tx, t.spec); err != nil {
+				return &StageError{Stage: "swap", Table: t.spec.Name, Err: err}
+			}
+			err := tx.SetTableLoad(ctx, t.spec.Name, state.TableLoad{
+				Month:    month,
+				URL:      rep.MonthURL,
+				Manifest: tableManifest(items, t.spec.Name),
+				Reason:   rep.Reasons[t.spec.Name],
+				Rows:     rep.LoadedRows[t.spec.Name],
+				RunID:    rep.history.runID(),
+			})
+			if err != nil {
+				return &StageError{Stage: "swap", Table: t.spec.Name, Err: err}
+			}
+		}
+		if !complete {
+			return nil
+		}
+		return tx.SetLoaded(ctx, month, rep.MonthURL)
+	})
 }
 
-func enabledTableNames(cfg config.Config) []string {
-	var out []string
-	if cfg.LoadEmpresa {
-		out = append(out, "empresa")
-	}
-	if cfg.LoadEstabelecimento {
-		out = append(out, "estabelecimento")
-	}
-	if cfg.LoadSocios {
-		out = append(out, "socios")
-	}
-	if cfg.LoadSimples {
-		out = append(out, "simples")
-	}
-	if cfg.LoadCnae {
-		out = append(out, "cnae")
-	}
-	if cfg.LoadMoti {
-		out = append(out, "moti")
-	}
-	if cfg.LoadMunic {
-		out = append(out, "munic")
-	}
-	if cfg.LoadNatju {
-		out = append(out, "natju")
-	}
-	if cfg.LoadPais {
-		out = append(out, "pais")
-	}
-	if cfg.LoadQuals {
-		out = append(out, "quals")
+// dropStaging removes the staging tables of a failed run; the next run would
+// drop them anyway, but they can be as large as the live ones.
+func dropStaging(ctx context.Context, sqlDB *sql.DB, tasks []loadTask) {
+	dctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	for _, t := range tasks {
+		if err := loaders.DropStaging(dctx, sqlDB, t.spec); err != nil {
+			slog.Warn("could not drop staging table", "table", t.spec.Name, "error", err)
+		}
 	}
-	return out
 }
 
-func tableMonthMetaKey(table string) string { return "loaded_month_" + strings.ToLower(table) }
-func tableURLMetaKey(table string) string   { return "loaded_url_" + strings.ToLower(table) }
-
 func hasAnyTableToLoad(shouldLoad map[string]bool) bool {
 	for _, load := range shouldLoad {
 		if load {
@@ -490,50 +767,9 @@ func hasAnyTableToLoad(shouldLoad map[string]bool) bool {
 	return false
 }
 
-func wantedFromTableMap(m map[string]bool) downloader.Wanted {
-	return downloader.Wanted{
-		Empresas:         m["empresa"],
-		Estabelecimentos: m["estabelecimento"],
-		Socios:           m["socios"],
-		Simples:          m["simples"],
-		Motivos:          m["moti"],
-		Qualificacoes:    m["quals"],
-		Cnaes:            m["cnae"],
-		Municipios:       m["munic"],
-		Naturezas:        m["natju"],
-		Paises:           m["pais"],
-	}
-}
-
 func yearMonthLess(a, b timeutil.YearMonth) bool {
 	if a.Year != b.Year {
 		return a.Year < b.Year
 	}
 	return a.Month < b.Month
 }
-
-func formatMonthURLForEmail(raw string) string {
-	const davPrefix = "https://arquivos.receitafederal.gov.br/public.php/dav/files/gn672Ad4CF8N6TK"
-	const webPrefix = "https://arquivos.receitafederal.gov.br/index.php/s/gn672Ad4CF8N6TK?dir="
-
-	if strings.HasPrefix(raw, davPrefix) {
-		path := strings.TrimPrefix(raw, davPrefix)
-		path = strings.TrimSuffix(path, "/")
-		return webPrefix + path
-	}
-	return raw
-}
-
-func formatTimeInOffset(t time.Time, offset string) time.Time {
-	offset = strings.TrimSpace(offset)
-	if offset == "" {
-		return t
-	}
-	parsed, err := time.Parse("-07:00", offset)
-	if err != nil {
-		return t
-	}
-	_, secs := parsed.Zone()
-	loc := time.FixedZone("UTC"+offset, secs)
-	return t.In(loc)
-}
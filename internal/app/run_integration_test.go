@@ -0,0 +1,367 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/config"
+	"github.com/abriciof/rfcnpj-loader/internal/davtest"
+	"github.com/abriciof/rfcnpj-loader/internal/db"
+	"github.com/abriciof/rfcnpj-loader/internal/migrate"
+	"github.com/abriciof/rfcnpj-loader/internal/state"
+)
+
+// TestRun_EndToEnd runs the whole pipeline against a fake DAV share and a real
+// Postgres. It drops and recreates the loaded tables and rfcnpj_meta, so it
+// only runs against the database named in E2E_DB_NAME.
+func TestRun_EndToEnd(t *testing.T) {
+	if strings.TrimSpace(os.Getenv("RUN_INTEGRATION")) != "1" {
+		t.Skip("set RUN_INTEGRATION=1 to run integration tests")
+	}
+
+	loadDotEnvForAppTest()
+
+	dbName := strings.TrimSpace(os.Getenv("E2E_DB_NAME"))
+	if dbName == "" {
+		t.Skip("set E2E_DB_NAME to a disposable database to run the end-to-end test")
+	}
+
+	cfg := config.Config{
+		DBHost: getenvDefault("DB_HOST", "localhost"),
+		DBPort: getenvDefault("DB_PORT", "5432"),
+		DBUser: getenvDefault("DB_USER", "postgres"),
+		DBPass: getenvDefault("DB_PASSWORD", "postgres"),
+		DBName: dbName,
+	}
+
+	ctx := context.Background()
+	sqlDB, err := db.OpenSQL(ctx, cfg.DBOptions())
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer sqlDB.Close()
+	for _, stmt := range []string{
+		`DROP TABLE IF EXISTS rfcnpj_schema_migrations`,
+		`DROP TABLE IF EXISTS rfcnpj_meta`,
+		`DROP TABLE IF EXISTS rfcnpj_run_stages`,
+		`DROP TABLE IF EXISTS rfcnpj_runs`,
+		`DROP TABLE IF EXISTS moti__new`,
+		`DROP TABLE IF EXISTS simples`,
+		`DROP TABLE IF EXISTS moti`,
+		`DROP TABLE IF EXISTS quals`,
+	} {
+		if _, err := sqlDB.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("reset database: %v", err)
+		}
+	}
+
+	fixtures := t.TempDir()
+	writeMonth := func(month, day string, motivos int) {
+		t.Helper()
+		var moti strings.Builder
+		for i := 0; i < motivos; i++ {
+			moti.WriteString(`"` + string(rune('0'+i)) + `";"MOTIVO"` + "\n")
+		}
+		err := davtest.WriteMonth(fixtures, month, map[string]map[string]string{
+			"Simples.zip": {
+				"F.K03200$W.SIMPLES.CSV.D" + day: `"12345678";"S";"20200101";"00000000";"N";"00000000";"00000000"` + "\n" +
+					`"87654321";"N";"00000000";"00000000";"N";"00000000";"00000000"` + "\n",
+			},
+			"Motivos.zip":       {"F.K03200$Z.D" + day + ".MOTICSV": moti.String()},
+			"Qualificacoes.zip": {"F.K03200$Z.D" + day + ".QUALSCSV": `"05";"Administrador"` + "\n"},
+			"Empresas0.zip":     {"K3241.K03200Y0.D" + day + ".EMPRECSV": `"12345678";"X";"2062";"49";"1000,00";"01";""` + "\n"},
+		}, time.Time{})
+		if err != nil {
+			t.Fatalf("write fixture %s: %v", month, err)
+		}
+	}
+	writeMonth("2026-01", "60110", 3)
+	writeMonth("2026-02", "60210", 4)
+
+	srv := davtest.NewServer(fixtures, davtest.Options{Months: []string{"2026-01"}})
+	defer srv.Close()
+
+	work := t.TempDir()
+	cfg.OutputFilesPath = filepath.Join(work, "output")
+	cfg.ExtractedFilesPath = filepath.Join(work, "extracted")
+	cfg.DavBaseDomain = srv.BaseDomain()
+	cfg.DavListURLTemplate = srv.ListURLTemplate()
+	cfg.StartMonth = "2026-01"
+	cfg.EnableDownload = true
+	cfg.EnableExtract = true
+	cfg.Tables = enabledTables("simples", "moti", "quals")
+	cfg.DownloadWorkers = 2
+	cfg.ExtractWorkers = 2
+	cfg.TableWorkers = 2
+	cfg.FileWorkers = 2
+
+	if _, err := Run(ctx, cfg); err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	assertCount(t, sqlDB, `SELECT count(*) FROM simples`, 2)
+	assertCount(t, sqlDB, `SELECT count(*) FROM moti`, 3)
+	assertCount(t, sqlDB, `SELECT count(*) FROM quals`, 1)
+	assertMeta(t, sqlDB, "loaded_month_moti", "2026-01")
+	assertMeta(t, sqlDB, "loaded_run_moti", "1")
+	if rep, err := migrate.Check(ctx, sqlDB, ""); err != nil || rep.Pending() != 0 || len(rep.Unknown) != 0 {
+		t.Fatalf("schema not migrated: %+v %v", rep, err)
+	}
+	assertCount(t, sqlDB, `SELECT count(*) FROM rfcnpj_meta WHERE key = 'loaded_manifest_hash_moti' AND length(value) = 64`, 1)
+	assertCount(t, sqlDB, `SELECT count(*) FROM pg_tables WHERE tablename LIKE '%\_\_new'`, 0)
+
+	for _, r := range srv.Requests() {
+		if strings.Contains(r.Path, "Empresas") {
+			t.Fatalf("disabled table zip should not be downloaded: %+v", r)
+		}
+	}
+
+	// 2026-02 is not published yet: nothing to do.
+	if out, err := Run(ctx, cfg); err != nil || out != UpToDate {
+		t.Fatalf("up-to-date run: outcome %v, error %v", out, err)
+	}
+	assertMeta(t, sqlDB, "loaded_month_moti", "2026-01")
+
+	srv.SetMonths("2026-01", "2026-02")
+	if out, err := Run(ctx, cfg); err != nil || out != Done {
+		t.Fatalf("second month run: outcome %v, error %v", out, err)
+	}
+	assertCount(t, sqlDB, `SELECT count(*) FROM moti`, 4)
+	assertMeta(t, sqlDB, "loaded_month_moti", "2026-02")
+	assertMeta(t, sqlDB, "loaded_month", "2026-02")
+
+	// Receita republishes Motivos.zip inside 2026-02: only moti is reloaded.
+	republishedAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := davtest.WriteMonth(fixtures, "2026-02", map[string]map[string]string{
+		"Motivos.zip": {"F.K03200$Z.D60210.MOTICSV": `"0";"A"` + "\n" + `"1";"B"` + "\n"},
+	}, republishedAt); err != nil {
+		t.Fatalf("republish fixture: %v", err)
+	}
+	if _, err := sqlDB.ExecContext(ctx, `INSERT INTO simples (cnpj_basico) VALUES ('sentinel')`); err != nil {
+		t.Fatalf("insert sentinel: %v", err)
+	}
+	if _, err := Run(ctx, cfg); err != nil {
+		t.Fatalf("republish run failed: %v", err)
+	}
+	assertCount(t, sqlDB, `SELECT count(*) FROM moti`, 2)
+	assertCount(t, sqlDB, `SELECT count(*) FROM simples WHERE cnpj_basico = 'sentinel'`, 1)
+	assertMeta(t, sqlDB, "loaded_month_moti", "2026-02")
+
+	assertCount(t, sqlDB, `SELECT count(*) FROM rfcnpj_runs WHERE status = 'loaded' AND trigger = 'manual'`, 3)
+	assertCount(t, sqlDB, `SELECT count(*) FROM rfcnpj_runs WHERE status = 'up_to_date' AND month = '2026-02'`, 1)
+	assertCount(t, sqlDB, `SELECT count(*) FROM rfcnpj_runs WHERE finished_at IS NULL OR error <> ''`, 0)
+	assertCount(t, sqlDB, `SELECT (table_rows->>'moti')::bigint FROM rfcnpj_runs ORDER BY id DESC LIMIT 1`, 2)
+	assertCount(t, sqlDB, `SELECT count(*) FROM rfcnpj_runs WHERE id = (SELECT min(id) FROM rfcnpj_runs) AND bytes_downloaded > 0`, 1)
+	assertCount(t, sqlDB, `SELECT count(*) FROM rfcnpj_run_stages WHERE status <> 'done' OR finished_at IS NULL`, 0)
+	assertCount(t, sqlDB, `SELECT count(DISTINCT run_id) FROM rfcnpj_run_stages WHERE stage = 'load'`, 3)
+}
+
+// TestRun_SchemasShareDatabase runs two loaders with different TARGET_SCHEMA
+// and the same DB_SEARCH_PATH against one database: each keeps its own
+// rfcnpj_meta, rfcnpj_runs and migrations, none of them in the search_path.
+func TestRun_SchemasShareDatabase(t *testing.T) {
+	if strings.TrimSpace(os.Getenv("RUN_INTEGRATION")) != "1" {
+		t.Skip("set RUN_INTEGRATION=1 to run integration tests")
+	}
+
+	loadDotEnvForAppTest()
+
+	dbName := strings.TrimSpace(os.Getenv("E2E_DB_NAME"))
+	if dbName == "" {
+		t.Skip("set E2E_DB_NAME to a disposable database to run the end-to-end test")
+	}
+
+	base := config.Config{
+		DBHost:       getenvDefault("DB_HOST", "localhost"),
+		DBPort:       getenvDefault("DB_PORT", "5432"),
+		DBUser:       getenvDefault("DB_USER", "postgres"),
+		DBPass:       getenvDefault("DB_PASSWORD", "postgres"),
+		DBName:       dbName,
+		DBSearchPath: "public",
+	}
+
+	ctx := context.Background()
+	sqlDB, err := db.OpenSQL(ctx, base.DBOptions())
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer sqlDB.Close()
+	schemas := []string{"rfcnpj_it_prod", "rfcnpj_it_staging"}
+	for _, s := range schemas {
+		if _, err := sqlDB.ExecContext(ctx, `DROP SCHEMA IF EXISTS `+s+` CASCADE`); err != nil {
+			t.Fatalf("reset schema %s: %v", s, err)
+		}
+	}
+
+	fixtures := t.TempDir()
+	if err := davtest.WriteMonth(fixtures, "2026-01", map[string]map[string]string{
+		"Motivos.zip": {"F.K03200$Z.D60110.MOTICSV": `"0";"A"` + "\n" + `"1";"B"` + "\n"},
+	}, time.Time{}); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	srv := davtest.NewServer(fixtures, davtest.Options{Months: []string{"2026-01"}})
+	defer srv.Close()
+
+	for _, schema := range schemas {
+		cfg := base
+		cfg.TargetSchema = schema
+		work := t.TempDir()
+		cfg.OutputFilesPath = filepath.Join(work, "output")
+		cfg.ExtractedFilesPath = filepath.Join(work, "extracted")
+		cfg.DavBaseDomain = srv.BaseDomain()
+		cfg.DavListURLTemplate = srv.ListURLTemplate()
+		cfg.StartMonth = "2026-01"
+		cfg.EnableDownload = true
+		cfg.EnableExtract = true
+		cfg.Tables = enabledTables("moti")
+		for i := range cfg.Tables {
+			cfg.Tables[i].Schema = schema
+		}
+
+		// the other schema was migrated already; this one still isn't
+		if rep, err := migrate.Check(ctx, sqlDB, schema); err != nil || rep.Pending() != len(rep.Migrations) {
+			t.Fatalf("%s: expected every migration pending, got %+v %v", schema, rep, err)
+		}
+		if out, err := Run(ctx, cfg); err != nil || out != Done {
+			t.Fatalf("%s: run: outcome %v, error %v", schema, out, err)
+		}
+		if rep, err := migrate.Check(ctx, sqlDB, schema); err != nil || rep.Pending() != 0 {
+			t.Fatalf("%s: schema not migrated: %+v %v", schema, rep, err)
+		}
+		got, ok, err := state.NewMetaStore(sqlDB, schema).Get(ctx, "loaded_month_moti")
+		if err != nil || !ok || got != "2026-01" {
+			t.Fatalf("%s: loaded_month_moti = %q (present=%v, err=%v)", schema, got, ok, err)
+		}
+		assertCount(t, sqlDB, `SELECT count(*) FROM `+schema+`.moti`, 2)
+		assertCount(t, sqlDB, `SELECT count(*) FROM `+schema+`.rfcnpj_runs WHERE status = 'loaded'`, 1)
+	}
+	assertCount(t, sqlDB, `SELECT count(*) FROM pg_tables WHERE schemaname IN ('rfcnpj_it_prod', 'rfcnpj_it_staging') AND tablename IN ('rfcnpj_meta', 'rfcnpj_runs', 'rfcnpj_run_stages', 'rfcnpj_schema_migrations')`, 8)
+}
+
+// TestStatus_BaselineMeta reads a database set up before the migrations:
+// rfcnpj_meta exists and rfcnpj_schema_migrations doesn't.
+func TestStatus_BaselineMeta(t *testing.T) {
+	if strings.TrimSpace(os.Getenv("RUN_INTEGRATION")) != "1" {
+		t.Skip("set RUN_INTEGRATION=1 to run integration tests")
+	}
+
+	loadDotEnvForAppTest()
+
+	dbName := strings.TrimSpace(os.Getenv("E2E_DB_NAME"))
+	if dbName == "" {
+		t.Skip("set E2E_DB_NAME to a disposable database to run the end-to-end test")
+	}
+
+	const schema = "rfcnpj_it_baseline"
+	cfg := config.Config{
+		DBHost:       getenvDefault("DB_HOST", "localhost"),
+		DBPort:       getenvDefault("DB_PORT", "5432"),
+		DBUser:       getenvDefault("DB_USER", "postgres"),
+		DBPass:       getenvDefault("DB_PASSWORD", "postgres"),
+		DBName:       dbName,
+		TargetSchema: schema,
+		Tables:       enabledTables("moti"),
+	}
+
+	ctx := context.Background()
+	sqlDB, err := db.OpenSQL(ctx, cfg.DBOptions())
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer sqlDB.Close()
+	for _, stmt := range []string{
+		`DROP SCHEMA IF EXISTS ` + schema + ` CASCADE`,
+		`CREATE SCHEMA ` + schema,
+		`CREATE TABLE ` + schema + `.rfcnpj_meta (key text PRIMARY KEY, value text NOT NULL, updated_at timestamptz NOT NULL DEFAULT now())`,
+		`INSERT INTO ` + schema + `.rfcnpj_meta(key, value) VALUES ('loaded_month_moti', '2026-01'), ('loaded_rows_moti', '3')`,
+	} {
+		if _, err := sqlDB.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed baseline meta: %v", err)
+		}
+	}
+
+	meta, err := readMeta(ctx, cfg, sqlDB)
+	if err != nil || meta == nil {
+		t.Fatalf("readMeta: meta %v, error %v", meta, err)
+	}
+	var sb strings.Builder
+	if err := Status(ctx, cfg, &sb); err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if !strings.Contains(sb.String(), "2026-01") || !strings.Contains(sb.String(), "3") {
+		t.Fatalf("status should show the baseline load:\n%s", sb.String())
+	}
+}
+
+func assertCount(t *testing.T, sqlDB *sql.DB, query string, want int64) {
+	t.Helper()
+
+	var got int64
+	if err := sqlDB.QueryRowContext(context.Background(), query).Scan(&got); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	if got != want {
+		t.Fatalf("%s: got %d want %d", query, got, want)
+	}
+}
+
+func assertMeta(t *testing.T, sqlDB *sql.DB, key, want string) {
+	t.Helper()
+
+	got, ok, err := state.NewMetaStore(sqlDB, "").Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("read meta %s: %v", key, err)
+	}
+	if !ok || got != want {
+		t.Fatalf("meta %s: got %q (present=%v) want %q", key, got, ok, want)
+	}
+}
+
+func getenvDefault(k, def string) string {
+	if v := strings.TrimSpace(os.Getenv(k)); v != "" {
+		return v
+	}
+	return def
+}
+
+func loadDotEnvForAppTest() {
+	wd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+
+	envPath := filepath.Clean(filepath.Join(wd, "..", "..", ".env"))
+	f, err := os.Open(envPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		val := strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+		if key == "" {
+			continue
+		}
+
+		if _, exists := os.LookupEnv(key); !exists {
+			_ = os.Setenv(key, val)
+		}
+	}
+}
@@ -1,11 +1,27 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/abriciof/rfcnpj-loader/internal/config"
+	"github.com/abriciof/rfcnpj-loader/internal/davtest"
+	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+	"github.com/abriciof/rfcnpj-loader/internal/migrate"
+	runreport "github.com/abriciof/rfcnpj-loader/internal/report"
 	"github.com/abriciof/rfcnpj-loader/internal/scan"
 	"github.com/abriciof/rfcnpj-loader/internal/timeutil"
 )
@@ -14,14 +30,15 @@ func TestBuildLoadTasks_IncludesEnabledAndSorted(t *testing.T) {
 	t.Parallel()
 
 	cfg := config.Config{
-		LoadSocios:  true,
-		LoadEmpresa: true,
-		LoadMoti:    true,
+		Tables:      enabledTables("socios", "empresa", "moti"),
+		FileWorkers: 2,
 	}
+	cfg.Tables[0].FileWorkers = 6 // empresa
 	fb := scan.FilesByType{
-		Empresa: []string{"empresa.csv"},
-		Socios:  []string{"socios.csv"},
-		Moti:    []string{"moti.csv"},
+		"empresa": []string{"empresa.csv"},
+		"socios":  []string{"socios.csv"},
+		"moti":    []string{"moti.csv"},
+		"cnae":    []string{"cnae.csv"},
 	}
 
 	tasks := buildLoadTasks(cfg, fb)
@@ -36,9 +53,28 @@ func TestBuildLoadTasks_IncludesEnabledAndSorted(t *testing.T) {
 			t.Fatalf("unexpected order at %d: got %s want %s", i, gotOrder[i], wantOrder[i])
 		}
 	}
+	if tasks[0].fileWorkers != 6 || tasks[1].fileWorkers != 2 {
+		t.Fatalf("unexpected file workers: %d, %d", tasks[0].fileWorkers, tasks[1].fileWorkers)
+	}
+	if len(tasks[0].spec.Indexes) != 1 || tasks[0].spec.Indexes[0].Name != "empresa_cnpj" {
+		t.Fatalf("expected the registry index for empresa, got %+v", tasks[0].spec.Indexes)
+	}
+}
+
+// enabledTables is the table list of the registry with only names enabled.
+func enabledTables(names ...string) []config.TableConfig {
+	on := map[string]bool{}
+	for _, n := range names {
+		on[n] = true
+	}
+	var out []config.TableConfig
+	for _, s := range loaders.All {
+		out = append(out, config.TableConfig{Name: s.Name, Enabled: on[s.Name]})
+	}
+	return out
 }
 
-func TestFormatReport(t *testing.T) {
+func TestMessages_Finished(t *testing.T) {
 	t.Parallel()
 
 	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
@@ -55,9 +91,23 @@ func TestFormatReport(t *testing.T) {
 			"socios":  20,
 			"empresa": 10,
 		},
+		Drift: []*loaders.Drift{{
+			Table:    "socios",
+			File:     "SOCIOCSV",
+			Expected: 11,
+			Observed: map[int]int64{11: 19, 12: 1},
+			Samples:  map[int][]int{12: {7}},
+		}},
 	}
 
-	out := formatReport(rep)
+	ev, err := testMessages(t, "", "").finished(rep)
+	if err != nil {
+		t.Fatalf("finished: %v", err)
+	}
+	if ev.Subject != "RFCNPJ Loader finalizado - 2026-01" {
+		t.Fatalf("unexpected subject %q", ev.Subject)
+	}
+	out := ev.Text
 	required := []string{
 		"RFCNPJ Loader - Finalizado",
 		"Mês: Janeiro de 2026 (2026-01)",
@@ -68,6 +118,7 @@ func TestFormatReport(t *testing.T) {
 		"Arquivos extraídos: 2",
 		"- empresa: 10",
 		"- socios: 20",
+		"socios (SOCIOCSV): esperado 11 colunas; observado 12 colunas em 1 linha(s) (ex.: linhas 7)",
 	}
 	for _, s := range required {
 		if !strings.Contains(out, s) {
@@ -75,3 +126,511 @@ func TestFormatReport(t *testing.T) {
 		}
 	}
 }
+
+func TestMessages_FinishedPreviousRowsAndStages(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	rep := report{
+		Month:        timeutil.YearMonth{Year: 2026, Month: 2},
+		MonthURL:     "https://example.test/2026-02/",
+		StartedAt:    start,
+		FinishedAt:   start.Add(time.Hour),
+		LoadedRows:   map[string]int64{"empresa": 120, "socios": 90},
+		PreviousRows: map[string]int64{"empresa": 100, "socios": 95},
+		Reasons:      map[string]string{"empresa": "mês novo"},
+		Stages:       []stageTiming{{Name: "download", Duration: 3 * time.Minute}, {Name: "load", Duration: 40 * time.Minute}},
+		Warnings:     []string{"<script>alert(1)</script>"},
+	}
+
+	ev, err := testMessages(t, "", "").finished(rep)
+	if err != nil {
+		t.Fatalf("finished: %v", err)
+	}
+	text := ev.Text
+	for _, s := range []string{
+		"- empresa: 120 (anterior 100, +20)",
+		"- socios: 90 (anterior 95, -5)",
+		"- download: 3m0s",
+		"- load: 40m0s",
+	} {
+		if !strings.Contains(text, s) {
+			t.Fatalf("text report missing %q\nreport:\n%s", s, text)
+		}
+	}
+
+	html := ev.HTML
+	for _, s := range []string{
+		"<td>empresa</td><td align=\"right\">120</td><td align=\"right\">100</td><td align=\"right\">&#43;20</td><td>mês novo</td>",
+		"<td align=\"right\">-5</td>",
+		"<td>load</td><td align=\"right\">40m0s</td>",
+		"&lt;script&gt;",
+	} {
+		if !strings.Contains(html, s) {
+			t.Fatalf("html report missing %q\nreport:\n%s", s, html)
+		}
+	}
+}
+
+func TestNewNotifier_ChannelsFromConfig(t *testing.T) {
+	t.Parallel()
+
+	n, err := newNotifier(config.Config{
+		NotifyEvents:     "finished,failed",
+		NotifyWebhookURL: "http://hooks.test/x",
+		TelegramBotToken: "123:abc",
+		TelegramChatID:   "-1",
+		// SMTP sem senha: canal desabilitado
+		SMTPUser: "loader@example.test",
+		MailTo:   "team@example.test",
+	})
+	if err != nil {
+		t.Fatalf("newNotifier: %v", err)
+	}
+	var names []string
+	for _, ch := range n.Channels {
+		names = append(names, ch.Name())
+	}
+	if strings.Join(names, ",") != "webhook,telegram" {
+		t.Fatalf("unexpected channels %v", names)
+	}
+
+	if _, err := newNotifier(config.Config{NotifyEvents: "finished,sometimes"}); err == nil {
+		t.Fatalf("expected error for invalid NOTIFY_EVENTS")
+	}
+}
+
+func TestMessages_FailedLoadStage(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	rep := report{
+		Month:      timeutil.YearMonth{Year: 2026, Month: 3},
+		StartedAt:  start,
+		FinishedAt: start.Add(5 * time.Minute),
+		LoadedRows: map[string]int64{"empresa": 10},
+		Stages:     []stageTiming{{Name: "list", Duration: time.Second}, {Name: "download", Duration: time.Minute}},
+		Current:    "load",
+	}
+	cause := errors.New("ERROR: value too long for type character varying(2)")
+	err := fmt.Errorf("load failed: %w", &StageError{Stage: "load", Table: "socios", File: "/x/SOCIOCSV", Err: cause})
+
+	ev, rerr := testMessages(t, "", "").failed(rep, err, false)
+	if rerr != nil {
+		t.Fatalf("failed: %v", rerr)
+	}
+	if ev.Subject != "RFCNPJ Loader falhou - 2026-03" {
+		t.Fatalf("unexpected subject %q", ev.Subject)
+	}
+	out := ev.Text
+	for _, s := range []string{
+		"RFCNPJ Loader - Falhou",
+		"Mês: Março de 2026 (2026-03)",
+		"Etapa: load\n",
+		"Tabela: socios",
+		"Arquivo: /x/SOCIOCSV",
+		"Erro: load failed: etapa load (tabela socios, arquivo /x/SOCIOCSV): ERROR: value too long",
+		"- ERROR: value too long for type character varying(2)",
+		"- list: 1s",
+		"- download: 1m0s",
+		"- empresa: 10",
+		"FORCE_MONTH=2026-03",
+		"a carga ia para <tabela>__new",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("failure report missing %q\nreport:\n%s", s, out)
+		}
+	}
+}
+
+func TestMessages_English(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	rep := report{
+		Month:        timeutil.YearMonth{Year: 2026, Month: 3},
+		StartedAt:    start,
+		FinishedAt:   start.Add(time.Hour),
+		LoadedRows:   map[string]int64{"empresa": 120},
+		PreviousRows: map[string]int64{"empresa": 100},
+	}
+	m := testMessages(t, "en", "")
+
+	ev, err := m.finished(rep)
+	if err != nil {
+		t.Fatalf("finished: %v", err)
+	}
+	for _, s := range []string{"Month: March 2026 (2026-03)", "Rows loaded per table:", "- empresa: 120 (previous 100, +20)"} {
+		if !strings.Contains(ev.Text, s) {
+			t.Fatalf("english report missing %q\nreport:\n%s", s, ev.Text)
+		}
+	}
+
+	ev, err = m.upToDate(rep, false)
+	if err != nil {
+		t.Fatalf("upToDate: %v", err)
+	}
+	if ev.Kind != "up_to_date" || !strings.Contains(ev.Text, "March 2026") {
+		t.Fatalf("unexpected up-to-date event %+v", ev)
+	}
+}
+
+func TestMessages_OverrideDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	custom := `{{define "subject"}}Carga {{.Month}} ok{{end}}{{define "text"}}{{range .Tables}}{{.Table}}={{.Rows}};{{end}}{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "finished.txt"), []byte(custom), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	m := testMessages(t, "pt-BR", dir)
+
+	rep := report{
+		Month:      timeutil.YearMonth{Year: 2026, Month: 1},
+		LoadedRows: map[string]int64{"empresa": 10, "moti": 2},
+	}
+	ev, err := m.finished(rep)
+	if err != nil {
+		t.Fatalf("finished: %v", err)
+	}
+	if ev.Subject != "Carga 2026-01 ok" || ev.Text != "empresa=10;moti=2;" {
+		t.Fatalf("override not used: %q / %q", ev.Subject, ev.Text)
+	}
+	// os demais continuam vindo dos templates embutidos
+	if ev, _ := m.failed(rep, errors.New("boom"), false); !strings.Contains(ev.Text, "Erro: boom") {
+		t.Fatalf("embedded failed template not used:\n%s", ev.Text)
+	}
+}
+
+func testMessages(t *testing.T, locale, dir string) *messages {
+	t.Helper()
+	m, err := newMessages(config.Config{Locale: locale, TemplatesDir: dir})
+	if err != nil {
+		t.Fatalf("newMessages: %v", err)
+	}
+	return m
+}
+
+func TestWriteMigrateStatus(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	var sb strings.Builder
+	writeMigrateStatus(&sb, migrate.Report{
+		Migrations: []migrate.Status{
+			{Migration: migrate.Migration{Version: 1, Name: "meta"}, Applied: true, AppliedAt: at},
+			{Migration: migrate.Migration{Version: 2, Name: "runs"}},
+		},
+		Unknown: []int{7},
+	})
+	out := sb.String()
+	for _, s := range []string{"VERSION", "0001     meta  applied  2026-01-10T12:00:00Z", "0002     runs  pending", "0007     ?     unknown"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("status missing %q\n%s", s, out)
+		}
+	}
+}
+
+func TestValidateConfig_MasksSecretsAndListsProblems(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DAV_LIST_URL_TEMPLATE", "https://example.test/%s/")
+	t.Setenv("OUTPUT_FILES_PATH", filepath.Join(dir, "out"))
+	t.Setenv("EXTRACTED_FILES_PATH", filepath.Join(dir, "ext"))
+	t.Setenv("REPORT_DIR", "")
+	t.Setenv("DB_PASSWORD", "s3cret")
+	t.Setenv("LOAD_CNAE", "sim")
+
+	cfg, _ := config.Load()
+	var sb strings.Builder
+	err := ValidateConfig(cfg, &sb)
+	out := sb.String()
+	if strings.Contains(out, "s3cret") || !strings.Contains(out, "DB_PASSWORD") {
+		t.Fatalf("secret not masked:\n%s", out)
+	}
+	if !regexp.MustCompile(`table simples +carrega\n`).MatchString(out) {
+		t.Fatalf("tables not listed:\n%s", out)
+	}
+	if err == nil || !strings.Contains(err.Error(), "LOAD_CNAE") {
+		t.Fatalf("expected the LOAD_CNAE problem, got %v", err)
+	}
+
+	t.Setenv("LOAD_CNAE", "true")
+	cfg, _ = config.Load()
+	sb.Reset()
+	if err := ValidateConfig(cfg, &sb); err != nil || !strings.Contains(sb.String(), "configuração válida") {
+		t.Fatalf("expected a valid config, got %v\n%s", err, sb.String())
+	}
+}
+
+func TestRun_NotifiesFailure(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		events []map[string]any
+	)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&ev)
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	// porta sem ninguém escutando: a conexão com o banco falha na hora
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // como depois de um SIGTERM
+
+	cfg := config.Config{
+		DBHost:             "127.0.0.1",
+		DBPort:             port,
+		DBName:             "rfcnpj",
+		OutputFilesPath:    t.TempDir(),
+		ExtractedFilesPath: t.TempDir(),
+		NotifyEvents:       "failed",
+		NotifyWebhookURL:   hook.URL,
+		ReportDir:          t.TempDir(),
+	}
+	if _, err := Run(ctx, cfg); err == nil {
+		t.Fatalf("expected Run to fail")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(events))
+	}
+	if events[0]["event"] != "failed" || events[0]["subject"] != "RFCNPJ Loader interrompido" {
+		t.Fatalf("unexpected event %v", events[0])
+	}
+	if text, _ := events[0]["text"].(string); !strings.Contains(text, "Etapa: connect (interrompida") {
+		t.Fatalf("unexpected text %q", text)
+	}
+	sent, _ := events[0]["report"].(map[string]any)
+	if sent["status"] != runreport.StatusInterrupted {
+		t.Fatalf("unexpected report in webhook: %v", events[0]["report"])
+	}
+
+	b, err := os.ReadFile(filepath.Join(cfg.ReportDir, runreport.LatestFile))
+	if err != nil {
+		t.Fatalf("run report not written: %v", err)
+	}
+	var doc runreport.Report
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("decode run report: %v", err)
+	}
+	if doc.SchemaVersion != runreport.SchemaVersion || doc.Status != runreport.StatusInterrupted || doc.Error == nil || doc.Error.Stage != "connect" {
+		t.Fatalf("unexpected run report: %s", b)
+	}
+}
+
+func TestStageCommands_DownloadExtractVerify(t *testing.T) {
+	t.Parallel()
+
+	fixtures := t.TempDir()
+	err := davtest.WriteMonth(fixtures, "2026-01", map[string]map[string]string{
+		"Motivos.zip":   {"F.K03200$Z.D60110.MOTICSV": `"0";"A"` + "\n" + `"1";"B"` + "\n"},
+		"Empresas0.zip": {"K3241.K03200Y0.D60110.EMPRECSV": `"12345678";"X";"2062";"49";"1000,00";"01";""` + "\n"},
+	}, time.Time{})
+	if err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	if err := davtest.WriteMonth(fixtures, "2025-12", map[string]map[string]string{"Motivos.zip": {"a.MOTICSV": ""}}, time.Time{}); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	srv := davtest.NewServer(fixtures, davtest.Options{})
+	defer srv.Close()
+
+	work := t.TempDir()
+	cfg := config.Config{
+		DavBaseDomain:      srv.BaseDomain(),
+		DavListURLTemplate: srv.ListURLTemplate(),
+		ForceMonth:         "2026-01",
+		OutputFilesPath:    filepath.Join(work, "output"),
+		ExtractedFilesPath: filepath.Join(work, "extracted"),
+		DownloadWorkers:    2,
+		ExtractWorkers:     2,
+		Tables:             enabledTables("moti"),
+	}
+	ctx := context.Background()
+
+	var months strings.Builder
+	if err := ListMonths(ctx, cfg, &months); err != nil || months.String() != "2025-12\n2026-01\n" {
+		t.Fatalf("ListMonths = %q, %v", months.String(), err)
+	}
+
+	if out, err := Download(ctx, cfg); err != nil || out != Done {
+		t.Fatalf("Download: outcome %v, error %v", out, err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.OutputFilesPath, "Motivos.zip")); err != nil {
+		t.Fatalf("zip not downloaded: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.OutputFilesPath, "Empresas0.zip")); err == nil {
+		t.Fatalf("zip of a disabled table downloaded")
+	}
+	if out, err := Extract(ctx, cfg); err != nil || out != Done {
+		t.Fatalf("Extract: outcome %v, error %v", out, err)
+	}
+
+	// sem --month, verify usa o último mês extraído
+	cfg.ForceMonth = ""
+	var report strings.Builder
+	if err := Verify(cfg, &report); err != nil {
+		t.Fatalf("Verify returned error: %v\n%s", err, report.String())
+	}
+	if !regexp.MustCompile(`F\.K03200\$Z\.D60110\.MOTICSV\s+Motivos\.zip\s+moti\s+confirmed`).MatchString(report.String()) {
+		t.Fatalf("unexpected verify output:\n%s", report.String())
+	}
+
+	// um arquivo com o layout de outra tabela reprova a verificação
+	bad := filepath.Join(cfg.ExtractedFilesPath, "2026-01", "extra.MOTICSV")
+	if err := os.WriteFile(bad, []byte(`"1";"2";"3";"4"`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(cfg, io.Discard); err == nil || !strings.Contains(err.Error(), "extra.MOTICSV") {
+		t.Fatalf("expected a verify error about extra.MOTICSV, got %v", err)
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	t.Parallel()
+
+	var sb strings.Builder
+	writeStatus(&sb, []tableStatus{
+		{Table: "empresa", Enabled: true, Month: "2026-01", Rows: "42"},
+		{Table: "socios"},
+	})
+	out := sb.String()
+	for _, s := range []string{"TABLE    ENABLED  MONTH    ROWS", "empresa  true     2026-01  42", "socios   false    -        -"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("status missing %q\n%s", s, out)
+		}
+	}
+}
+
+func TestPlan_ListsTablesZipsAndDisk(t *testing.T) {
+	t.Parallel()
+
+	fixtures := t.TempDir()
+	err := davtest.WriteMonth(fixtures, "2026-01", map[string]map[string]string{
+		"Motivos.zip":       {"F.K03200$Z.D60110.MOTICSV": strings.Repeat(`"0";"A"`+"\n", 100)},
+		"Qualificacoes.zip": {"F.K03200$Z.D60110.QUALSCSV": `"05";"Administrador"` + "\n"},
+		"Empresas0.zip":     {"K3241.K03200Y0.D60110.EMPRECSV": `"12345678";"X";"2062";"49";"1000,00";"01";""` + "\n"},
+	}, time.Time{})
+	if err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	srv := davtest.NewServer(fixtures, davtest.Options{})
+	defer srv.Close()
+
+	work := t.TempDir()
+	cfg := config.Config{
+		DavBaseDomain:      srv.BaseDomain(),
+		DavListURLTemplate: srv.ListURLTemplate(),
+		ForceMonth:         "2026-01",
+		OutputFilesPath:    filepath.Join(work, "output"),
+		ExtractedFilesPath: filepath.Join(work, "extracted"),
+		EnableDownload:     true,
+		DownloadWorkers:    1,
+		Tables:             enabledTables("moti", "quals"),
+	}
+	ctx := context.Background()
+
+	// Motivos.zip já baixado: entra no disco pelo tamanho real, sem download
+	cfg.Tables = enabledTables("moti")
+	if _, err := Download(ctx, cfg); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	cfg.Tables = enabledTables("moti", "quals")
+
+	var sb strings.Builder
+	out, err := Plan(ctx, cfg, &sb)
+	if err != nil || out != Done {
+		t.Fatalf("Plan: outcome %v, error %v", out, err)
+	}
+	got := sb.String()
+	for _, re := range []string{
+		`Mês: 2026-01 \(http`,
+		`"moti"\s+FORCE_MONTH=2026-01`,
+		`"quals"\s+FORCE_MONTH=2026-01`,
+		`Motivos\.zip\s+moti\s+\d+ B\s+já baixado`,
+		`Qualificacoes\.zip\s+quals\s+\d+ B\s+baixar`,
+		`Download: \d+ B em 1 de 2 zips`,
+		`estimativa de 4x o zip para 1 zip`,
+	} {
+		if !regexp.MustCompile(re).MatchString(got) {
+			t.Fatalf("plan missing %s\n%s", re, got)
+		}
+	}
+	if strings.Contains(got, "Empresas0.zip") {
+		t.Fatalf("zip of a disabled table in the plan\n%s", got)
+	}
+	if _, err := os.Stat(cfg.ExtractedFilesPath); !os.IsNotExist(err) {
+		t.Fatalf("plan should not write to disk: %v", err)
+	}
+}
+
+func TestResolveTargetMonth_NoMetaIsFirstLoad(t *testing.T) {
+	t.Parallel()
+
+	fixtures := t.TempDir()
+	err := davtest.WriteMonth(fixtures, "2026-01", map[string]map[string]string{
+		"Motivos.zip": {"F.K03200$Z.D60110.MOTICSV": `"0";"A"` + "\n"},
+	}, time.Time{})
+	if err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	srv := davtest.NewServer(fixtures, davtest.Options{})
+	defer srv.Close()
+
+	// banco nunca migrado: o plano é o mesmo da primeira carga de run
+	cfg := config.Config{DavListURLTemplate: srv.ListURLTemplate(), StartMonth: "2026-01"}
+	plan, err := resolveTargetMonth(context.Background(), cfg, nil, []string{"moti"})
+	if err != nil {
+		t.Fatalf("resolveTargetMonth: %v", err)
+	}
+	if plan.Month.String() != "2026-01" || !plan.ShouldLoad["moti"] || plan.Reasons["moti"] != "primeira carga (START_MONTH=2026-01)" {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+
+	cfg.StartMonth = ""
+	if _, err := resolveTargetMonth(context.Background(), cfg, nil, []string{"moti"}); err == nil || !strings.Contains(err.Error(), "START_MONTH") {
+		t.Fatalf("expected START_MONTH error, got %v", err)
+	}
+}
+
+func TestScanMonth_FailsWhenTableToLoadHasNoFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "F.K03200$Z.D60110.QUALSCSV"), []byte(`"05";"Administrador"`+"\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	month, _ := timeutil.ParseYearMonth("2026-01")
+
+	if _, err := scanMonth(config.Config{}, dir, month, map[string]bool{"quals": true}, &report{}); err != nil {
+		t.Fatalf("scanMonth with files for every table: %v", err)
+	}
+	_, err := scanMonth(config.Config{}, dir, month, map[string]bool{"quals": true, "moti": true}, &report{})
+	if err == nil || !strings.Contains(err.Error(), "moti") || strings.Contains(err.Error(), "quals") {
+		t.Fatalf("expected an error naming moti only, got %v", err)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 30: "5.0 GiB"} {
+		if got := formatBytes(n); got != want {
+			t.Fatalf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
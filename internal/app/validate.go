@@ -0,0 +1,52 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/abriciof/rfcnpj-loader/internal/config"
+)
+
+// ValidateConfig prints the effective configuration, secrets masked, and
+// returns every problem found in it.
+func ValidateConfig(cfg config.Config, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, s := range cfg.Settings() {
+		src := "env"
+		if s.Default {
+			src = "padrão"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t(%s)\n", s.Key, s.Masked(), src)
+	}
+	fmt.Fprintln(tw)
+	for _, t := range cfg.Tables {
+		state := "desligada"
+		if t.Enabled {
+			state = "carrega"
+		}
+		var opts []string
+		if t.Schema != "" {
+			opts = append(opts, "schema="+t.Schema)
+		}
+		if t.FileWorkers > 0 {
+			opts = append(opts, fmt.Sprintf("file_workers=%d", t.FileWorkers))
+		}
+		if len(t.ColumnTypes) > 0 {
+			opts = append(opts, fmt.Sprintf("column_types=%d", len(t.ColumnTypes)))
+		}
+		if len(t.Filter) > 0 {
+			opts = append(opts, fmt.Sprintf("filter=%d", len(t.Filter)))
+		}
+		fmt.Fprintf(tw, "table %s\t%s\n", t.Name, strings.Join(append([]string{state}, opts...), " "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "\nconfiguração válida")
+	return nil
+}
@@ -1,13 +1,16 @@
 package config
 
 import (
-	"fmt"
-	"os"
-	"strconv"
 	"strings"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/db"
 )
 
 type Config struct {
+	// file with variables not set in the environment (ENV_FILE or --env-file)
+	EnvFile string
+
 	OutputFilesPath    string
 	ExtractedFilesPath string
 
@@ -16,6 +19,20 @@ type Config struct {
 	DBUser string
 	DBPass string
 	DBName string
+	// DATABASE_URL replaces the settings above; the TLS and session settings
+	// below apply to both (see db.Options)
+	DatabaseURL       string
+	DBSSLMode         string
+	DBSSLRootCert     string
+	DBSSLCert         string
+	DBSSLKey          string
+	DBApplicationName string
+	DBSearchPath      string
+	DBMaxConns        int
+	DBConnectTimeout  int
+	DBConnectRetries  int
+	// first wait between attempts, in seconds; doubled each time
+	DBConnectRetryDelay int
 
 	// WebDAV listing
 	DavBaseDomain      string
@@ -27,17 +44,15 @@ type Config struct {
 	EnableExtract  bool
 	CreateIndexes  bool
 
-	// what to load
-	LoadEmpresa         bool
-	LoadEstabelecimento bool
-	LoadSocios          bool
-	LoadSimples         bool
-	LoadCnae            bool
-	LoadMoti            bool
-	LoadMunic           bool
-	LoadNatju           bool
-	LoadPais            bool
-	LoadQuals           bool
+	// what to load: every table of the registry, from CONFIG_FILE, LOAD_*
+	// and --tables (see resolveTables)
+	ConfigFile string
+	Tables     []TableConfig
+	// where the tables go: TARGET_SCHEMA (also the schema of the loader's own
+	// tables) and the prefix/suffix of their names
+	TargetSchema string
+	TablePrefix  string
+	TableSuffix  string
 
 	// parallelism
 	DownloadWorkers int
@@ -45,102 +60,265 @@ type Config struct {
 	TableWorkers    int
 	FileWorkers     int
 
+	// extraction limits (0 = default of the extract package)
+	ExtractMaxEntryBytes int64
+	ExtractMaxTotalBytes int64
+	ExtractMaxRatio      float64
+
+	// what to do with extracted files that can't be tied to a table: warn|fail
+	ScanUnclassified string
+	// what to do when a file's content doesn't fit its table: fail|warn
+	SniffMismatch string
+	// records with a field count different from the table: warn|fail|ignore
+	LayoutDrift string
+
 	// email
-	SMTPHost          string
-	SMTPPort          int
-	SMTPUser          string
-	SMTPPass          string
-	MailTo            string
+	SMTPHost           string
+	SMTPPort           int
+	SMTPUser           string
+	SMTPPass           string
+	MailTo             string
 	MailNotifyUpToDate bool
+	// SMTP_TLS: auto|none|starttls|implicit; SMTP_AUTH: auto|none|plain|login|cram-md5
+	SMTPTLS      string
+	SMTPAuth     string
+	MailFrom     string
+	MailFromName string
+	MailReplyTo  string
+	MailCc       string
+	MailBcc      string
+
+	// notifications: events sent to every configured channel
+	NotifyEvents        string
+	NotifyWebhookURL    string
+	NotifyWebhookSecret string
+	NotifySlackURL      string
+	TelegramBotToken    string
+	TelegramChatID      string
+	TelegramAPIURL      string
 
-	LogLevel string
+	LogLevel        string
 	ReportUTCOffset string
+	// directory for the JSON run report of every run (empty disables)
+	ReportDir string
+	// attach the run report to e-mails: none|json|csv
+	MailAttachReport string
+	// language of the notifications (pt-BR|en) and optional directory with
+	// templates that replace the embedded ones
+	Locale       string
+	TemplatesDir string
+	// recorded in rfcnpj_runs.trigger (ex.: cron, manual)
+	RunTrigger string
+	// what to do when another run holds the lock: wait|skip|fail
+	LockMode string
+	// maximum wait for LockMode=wait; 0 waits forever
+	LockWaitTimeout int
+
+	// values that didn't parse, reported by Validate
+	problems []string
+	// every setting read from the environment, for config validate
+	settings []Setting
+}
+
+// Overrides are the command line options that take precedence over the
+// environment.
+type Overrides struct {
+	// ConfigFile replaces CONFIG_FILE.
+	ConfigFile string
+	// Tables, when set, are the only tables loaded.
+	Tables []string
+	// EnvFile replaces ENV_FILE.
+	EnvFile string
+	// Month replaces FORCE_MONTH; the paths replace OUTPUT_FILES_PATH and
+	// EXTRACTED_FILES_PATH.
+	Month         string
+	OutputPath    string
+	ExtractedPath string
 }
 
 func Load() (Config, error) {
+	return LoadWith(Overrides{})
+}
+
+func LoadWith(o Overrides) (Config, error) {
+	p := &parser{}
+	// as variáveis do ambiente têm prioridade sobre as do arquivo
+	envFile := strings.TrimSpace(p.str("ENV_FILE", ""))
+	if o.EnvFile != "" {
+		envFile = o.EnvFile
+		p.set(envFile)
+	}
+	if envFile != "" {
+		var err error
+		if p.file, err = ReadEnvFile(envFile); err != nil {
+			p.problem("%v", err)
+		}
+	}
 	cfg := Config{
-		OutputFilesPath:    getenv("OUTPUT_FILES_PATH", "/data/output"),
-		ExtractedFilesPath: getenv("EXTRACTED_FILES_PATH", "/data/extracted"),
-
-		DBHost: getenv("DB_HOST", "localhost"),
-		DBPort: getenv("DB_PORT", "5432"),
-		DBUser: getenv("DB_USER", "postgres"),
-		DBPass: getenv("DB_PASSWORD", "postgres"),
-		DBName: getenv("DB_NAME", "rfcnpj"),
-
-		DavBaseDomain:      getenv("DAV_BASE_DOMAIN", "https://arquivos.receitafederal.gov.br"),
-		DavListURLTemplate: getenv("DAV_LIST_URL_TEMPLATE", ""),
-		StartMonth:         getenv("START_MONTH", ""),
-		ForceMonth:         getenv("FORCE_MONTH", ""),
-
-		EnableDownload: getenvBool("ENABLE_DOWNLOAD", true),
-		EnableExtract:  getenvBool("ENABLE_EXTRACT", true),
-		CreateIndexes:  getenvBool("CREATE_INDEXES", false),
-
-		LoadEmpresa:         getenvBool("LOAD_EMPRESA", false),
-		LoadEstabelecimento: getenvBool("LOAD_ESTABELECIMENTO", false),
-		LoadSocios:          getenvBool("LOAD_SOCIOS", false),
-		LoadSimples:         getenvBool("LOAD_SIMPLES", true),
-		LoadCnae:            getenvBool("LOAD_CNAE", false),
-		LoadMoti:            getenvBool("LOAD_MOTI", true),
-		LoadMunic:           getenvBool("LOAD_MUNIC", false),
-		LoadNatju:           getenvBool("LOAD_NATJU", false),
-		LoadPais:            getenvBool("LOAD_PAIS", false),
-		LoadQuals:           getenvBool("LOAD_QUALS", true),
-
-		DownloadWorkers: getenvInt("DOWNLOAD_WORKERS", 4),
-		ExtractWorkers:  getenvInt("EXTRACT_WORKERS", 2),
-		TableWorkers:    getenvInt("TABLE_WORKERS", 2),
-		FileWorkers:     getenvInt("FILE_WORKERS", 2),
-
-		SMTPHost: getenv("SMTP_HOST", "smtp.gmail.com"),
-		SMTPPort: getenvInt("SMTP_PORT", 587),
-		SMTPUser: getenv("SMTP_USER", ""),
-		SMTPPass: getenv("SMTP_PASS", ""),
-		MailTo:   getenv("MAIL_TO", ""),
-		MailNotifyUpToDate: getenvBool("MAIL_NOTIFY_UPTODATE", false),
-		LogLevel:           getenv("LOG_LEVEL", "info"),
-		ReportUTCOffset:    getenv("REPORT_UTC_OFFSET", "-04:00"),
+		EnvFile: envFile,
+
+		OutputFilesPath:    p.str("OUTPUT_FILES_PATH", "/data/output"),
+		ExtractedFilesPath: p.str("EXTRACTED_FILES_PATH", "/data/extracted"),
+
+		DBHost: p.str("DB_HOST", "localhost"),
+		DBPort: p.str("DB_PORT", "5432"),
+		DBUser: p.str("DB_USER", "postgres"),
+		DBPass: p.str("DB_PASSWORD", "postgres"),
+		DBName: p.str("DB_NAME", "rfcnpj"),
+
+		DatabaseURL:         p.str("DATABASE_URL", ""),
+		DBSSLMode:           strings.ToLower(p.str("DB_SSLMODE", "")),
+		DBSSLRootCert:       p.str("DB_SSLROOTCERT", ""),
+		DBSSLCert:           p.str("DB_SSLCERT", ""),
+		DBSSLKey:            p.str("DB_SSLKEY", ""),
+		DBApplicationName:   p.str("DB_APPLICATION_NAME", "rfcnpj-loader"),
+		DBSearchPath:        p.str("DB_SEARCH_PATH", ""),
+		DBMaxConns:          p.int("DB_MAX_CONNS", 10),
+		DBConnectTimeout:    p.int("DB_CONNECT_TIMEOUT_SECONDS", 10),
+		DBConnectRetries:    p.int("DB_CONNECT_RETRIES", 3),
+		DBConnectRetryDelay: p.int("DB_CONNECT_RETRY_DELAY_SECONDS", 2),
+
+		DavBaseDomain:      p.str("DAV_BASE_DOMAIN", "https://arquivos.receitafederal.gov.br"),
+		DavListURLTemplate: p.str("DAV_LIST_URL_TEMPLATE", ""),
+		StartMonth:         p.str("START_MONTH", ""),
+		ForceMonth:         p.str("FORCE_MONTH", ""),
+
+		EnableDownload: p.bool("ENABLE_DOWNLOAD", true),
+		EnableExtract:  p.bool("ENABLE_EXTRACT", true),
+		CreateIndexes:  p.bool("CREATE_INDEXES", false),
+
+		DownloadWorkers: p.int("DOWNLOAD_WORKERS", 4),
+		ExtractWorkers:  p.int("EXTRACT_WORKERS", 2),
+		TableWorkers:    p.int("TABLE_WORKERS", 2),
+		FileWorkers:     p.int("FILE_WORKERS", 2),
+
+		ExtractMaxEntryBytes: p.int64("EXTRACT_MAX_ENTRY_BYTES", 0),
+		ExtractMaxTotalBytes: p.int64("EXTRACT_MAX_TOTAL_BYTES", 0),
+		ExtractMaxRatio:      p.float("EXTRACT_MAX_RATIO", 0),
+
+		ScanUnclassified: strings.ToLower(p.str("SCAN_UNCLASSIFIED", "warn")),
+		SniffMismatch:    strings.ToLower(p.str("SNIFF_MISMATCH", "fail")),
+		LayoutDrift:      strings.ToLower(p.str("LAYOUT_DRIFT", "warn")),
+
+		SMTPHost:           p.str("SMTP_HOST", "smtp.gmail.com"),
+		SMTPPort:           p.int("SMTP_PORT", 587),
+		SMTPUser:           p.str("SMTP_USER", ""),
+		SMTPPass:           p.str("SMTP_PASS", ""),
+		MailTo:             p.str("MAIL_TO", ""),
+		MailNotifyUpToDate: p.bool("MAIL_NOTIFY_UPTODATE", false),
+		SMTPTLS:            smtpChoice(p.str("SMTP_TLS", "auto")),
+		SMTPAuth:           smtpChoice(p.str("SMTP_AUTH", "auto")),
+		MailFrom:           p.str("MAIL_FROM", ""),
+		MailFromName:       p.str("MAIL_FROM_NAME", ""),
+		MailReplyTo:        p.str("MAIL_REPLY_TO", ""),
+		MailCc:             p.str("MAIL_CC", ""),
+		MailBcc:            p.str("MAIL_BCC", ""),
+
+		NotifyWebhookURL:    p.str("NOTIFY_WEBHOOK_URL", ""),
+		NotifyWebhookSecret: p.str("NOTIFY_WEBHOOK_SECRET", ""),
+		NotifySlackURL:      p.str("NOTIFY_SLACK_WEBHOOK_URL", ""),
+		TelegramBotToken:    p.str("TELEGRAM_BOT_TOKEN", ""),
+		TelegramChatID:      p.str("TELEGRAM_CHAT_ID", ""),
+		TelegramAPIURL:      p.str("TELEGRAM_API_URL", "https://api.telegram.org"),
+
+		LogLevel:        p.str("LOG_LEVEL", "info"),
+		ReportUTCOffset: p.str("REPORT_UTC_OFFSET", "-04:00"),
+
+		ReportDir:        p.str("REPORT_DIR", "/data/reports"),
+		MailAttachReport: strings.ToLower(p.str("MAIL_ATTACH_REPORT", "none")),
+		Locale:           p.str("LOCALE", "pt-BR"),
+		TemplatesDir:     p.str("TEMPLATES_DIR", ""),
+		RunTrigger:       p.str("RUN_TRIGGER", "manual"),
+		LockMode:         strings.ToLower(p.str("LOCK_MODE", "wait")),
+		LockWaitTimeout:  p.int("LOCK_WAIT_TIMEOUT_SECONDS", 0),
+	}
+
+	// sem NOTIFY_EVENTS mantém o comportamento antigo: fim de carga e falhas,
+	// e "já atualizado" só com MAIL_NOTIFY_UPTODATE=true
+	defEvents := "finished,failed"
+	if cfg.MailNotifyUpToDate {
+		defEvents += ",up_to_date"
+	}
+	cfg.NotifyEvents = p.str("NOTIFY_EVENTS", defEvents)
+
+	cfg.ConfigFile = p.str("CONFIG_FILE", "")
+	if o.ConfigFile != "" {
+		cfg.ConfigFile = o.ConfigFile
+	}
+	var file File
+	if cfg.ConfigFile != "" {
+		var err error
+		if file, err = ReadFile(cfg.ConfigFile); err != nil {
+			p.problem("%v", err)
+		}
+	}
+	if o.Month != "" {
+		cfg.ForceMonth = o.Month
+	}
+	if o.OutputPath != "" {
+		cfg.OutputFilesPath = o.OutputPath
+	}
+	if o.ExtractedPath != "" {
+		cfg.ExtractedFilesPath = o.ExtractedPath
 	}
 
-	if strings.TrimSpace(cfg.DavListURLTemplate) == "" {
-		return Config{}, fmt.Errorf("DAV_LIST_URL_TEMPLATE não configurada")
+	cfg.TargetSchema = strings.TrimSpace(p.str("TARGET_SCHEMA", ""))
+	cfg.TablePrefix = strings.TrimSpace(p.str("TABLE_PREFIX", ""))
+	cfg.TableSuffix = strings.TrimSpace(p.str("TABLE_SUFFIX", ""))
+	cfg.Tables = resolveTables(p, file, o.Tables)
+	for i := range cfg.Tables {
+		t := &cfg.Tables[i]
+		if t.Schema == "" {
+			t.Schema = cfg.TargetSchema
+		}
+		t.Prefix, t.Suffix = cfg.TablePrefix, cfg.TableSuffix
 	}
+	cfg.problems, cfg.settings = p.problems, p.settings
 
+	// os caminhos só são conferidos por Validate, antes de serem usados
+	if err := cfg.check(false); err != nil {
+		return cfg, err
+	}
 	return cfg, nil
 }
 
-func getenv(k, def string) string {
-	v := os.Getenv(k)
-	if strings.TrimSpace(v) == "" {
-		return def
+// DBOptions is how to reach the database.
+func (c Config) DBOptions() db.Options {
+	return db.Options{
+		URL:               c.DatabaseURL,
+		Host:              c.DBHost,
+		Port:              c.DBPort,
+		User:              c.DBUser,
+		Password:          c.DBPass,
+		Name:              c.DBName,
+		SSLMode:           c.DBSSLMode,
+		SSLRootCert:       c.DBSSLRootCert,
+		SSLCert:           c.DBSSLCert,
+		SSLKey:            c.DBSSLKey,
+		ApplicationName:   c.DBApplicationName,
+		SearchPath:        c.searchPath(),
+		MaxConns:          c.DBMaxConns,
+		ConnectTimeout:    time.Duration(c.DBConnectTimeout) * time.Second,
+		ConnectRetries:    c.DBConnectRetries,
+		ConnectRetryDelay: time.Duration(c.DBConnectRetryDelay) * time.Second,
 	}
-	return v
 }
 
-func getenvInt(k string, def int) int {
-	v := strings.TrimSpace(os.Getenv(k))
-	if v == "" {
-		return def
-	}
-	n, err := strconv.Atoi(v)
-	if err != nil {
-		return def
+// searchPath is DB_SEARCH_PATH or, when not set, TARGET_SCHEMA first. The
+// loader's own tables don't depend on it: they are qualified with
+// TARGET_SCHEMA.
+func (c Config) searchPath() string {
+	if c.DBSearchPath != "" || c.TargetSchema == "" {
+		return c.DBSearchPath
 	}
-	return n
+	return c.TargetSchema + ",public"
 }
 
-func getenvBool(k string, def bool) bool {
-	v := strings.TrimSpace(strings.ToLower(os.Getenv(k)))
-	if v == "" {
-		return def
-	}
-	switch v {
-	case "1", "true", "yes", "y", "on":
-		return true
-	case "0", "false", "no", "n", "off":
-		return false
-	default:
-		return def
+// smtpChoice maps "auto" to the empty value the email package uses for it.
+func smtpChoice(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == "auto" {
+		return ""
 	}
+	return v
 }
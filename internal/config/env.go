@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Setting is a value read from the environment, as shown by config validate.
+type Setting struct {
+	Key   string
+	Value string
+	// Default is set when the variable is absent and the default is used.
+	Default bool
+	Secret  bool
+}
+
+// secretKeys are masked when settings are shown.
+var secretKeys = map[string]bool{
+	"DB_PASSWORD":              true,
+	"DATABASE_URL":             true,
+	"SMTP_PASS":                true,
+	"NOTIFY_WEBHOOK_SECRET":    true,
+	"NOTIFY_SLACK_WEBHOOK_URL": true,
+	"TELEGRAM_BOT_TOKEN":       true,
+}
+
+// Masked is the value to show: secrets are replaced when set, except for
+// the parts of a URL with credentials other than the password.
+func (s Setting) Masked() string {
+	if !s.Secret || s.Value == "" {
+		return s.Value
+	}
+	if u, err := url.Parse(s.Value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return "********"
+}
+
+// parser reads the environment. A value that doesn't parse keeps the default
+// and is recorded as a problem, so a typo is reported instead of ignored; the
+// setting shows what was typed.
+type parser struct {
+	problems []string
+	settings []Setting
+	// variables of ENV_FILE, used when absent from the environment
+	file map[string]string
+}
+
+func (p *parser) problem(format string, args ...any) {
+	p.problems = append(p.problems, fmt.Sprintf(format, args...))
+}
+
+// getenv is the variable k from the environment or, when absent, from
+// ENV_FILE.
+func (p *parser) getenv(k string) string {
+	if v, ok := os.LookupEnv(k); ok {
+		return v
+	}
+	return p.file[k]
+}
+
+// value is k or, when not set, the content of the file named by k_FILE (a
+// mounted secret, ex.: DB_PASSWORD_FILE=/run/secrets/db_password), without
+// the final line break.
+func (p *parser) value(k string) string {
+	v, path := p.getenv(k), strings.TrimSpace(p.getenv(k+"_FILE"))
+	if path == "" {
+		return v
+	}
+	if strings.TrimSpace(v) != "" {
+		p.problem("%s e %s_FILE configurados: use só um", k, k)
+		return v
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		p.problem("%s_FILE: %v", k, err)
+		return ""
+	}
+	return strings.TrimRight(string(b), "\r\n")
+}
+
+// lookup returns the value of k and records the setting with the value that
+// ends up being used; ok is false when k is empty.
+func (p *parser) lookup(k, def string) (v string, ok bool) {
+	v = p.value(k)
+	ok = strings.TrimSpace(v) != ""
+	p.settings = append(p.settings, Setting{Key: k, Value: def, Default: !ok, Secret: secretKeys[k]})
+	return v, ok
+}
+
+func (p *parser) set(v string) { p.settings[len(p.settings)-1].Value = v }
+
+func (p *parser) str(k, def string) string {
+	v, ok := p.lookup(k, def)
+	if !ok {
+		return def
+	}
+	p.set(v)
+	return v
+}
+
+func (p *parser) int(k string, def int) int {
+	v, ok := p.lookup(k, strconv.Itoa(def))
+	if !ok {
+		return def
+	}
+	v = strings.TrimSpace(v)
+	p.set(v)
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		p.problem("%s: número inteiro inválido %q", k, v)
+		return def
+	}
+	return n
+}
+
+func (p *parser) int64(k string, def int64) int64 {
+	v, ok := p.lookup(k, strconv.FormatInt(def, 10))
+	if !ok {
+		return def
+	}
+	v = strings.TrimSpace(v)
+	p.set(v)
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		p.problem("%s: número inteiro inválido %q", k, v)
+		return def
+	}
+	return n
+}
+
+func (p *parser) float(k string, def float64) float64 {
+	v, ok := p.lookup(k, strconv.FormatFloat(def, 'g', -1, 64))
+	if !ok {
+		return def
+	}
+	v = strings.TrimSpace(v)
+	p.set(v)
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		p.problem("%s: número inválido %q", k, v)
+		return def
+	}
+	return n
+}
+
+func (p *parser) bool(k string, def bool) bool {
+	v, ok := p.lookup(k, strconv.FormatBool(def))
+	if !ok {
+		return def
+	}
+	v = strings.TrimSpace(v)
+	p.set(v)
+	switch strings.ToLower(v) {
+	case "1", "true", "yes", "y", "on":
+		return true
+	case "0", "false", "no", "n", "off":
+		return false
+	default:
+		p.problem("%s: booleano inválido %q (use true ou false)", k, v)
+		return def
+	}
+}
+
+// ReadEnvFile reads a file of KEY=VALUE lines, like .env.example: blank
+// lines and lines starting with # are skipped, "export " is accepted and
+// quotes around the value are removed.
+func ReadEnvFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ENV_FILE: %w", err)
+	}
+	out := map[string]string{}
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" || strings.ContainsAny(k, " \t") {
+			return nil, fmt.Errorf("ENV_FILE %s, linha %d: esperado CHAVE=valor", path, i+1)
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		out[k] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+)
+
+// TableConfig is what is loaded into one table of the registry
+// (loaders.All). Every known table has one, enabled or not.
+type TableConfig struct {
+	Name    string
+	Enabled bool
+	// Indexes replaces the default indexes of the table when not nil; an
+	// empty list creates none. They are only built with CREATE_INDEXES.
+	Indexes []loaders.Index
+	// ColumnTypes (column -> Postgres type) are applied after the load.
+	ColumnTypes map[string]string
+	// Filter keeps only the rows whose column (key) has one of the values.
+	Filter map[string][]string
+	// Schema is the Postgres schema of the table, TARGET_SCHEMA by default;
+	// empty uses the search_path.
+	Schema string
+	// Prefix and Suffix are TABLE_PREFIX and TABLE_SUFFIX.
+	Prefix string
+	Suffix string
+	// FileWorkers overrides FILE_WORKERS for the table when > 0.
+	FileWorkers int
+}
+
+// Spec is the registry spec of the table with the options applied.
+func (t TableConfig) Spec() loaders.TableSpec {
+	spec, _ := loaders.Lookup(t.Name)
+	spec.Schema, spec.Prefix, spec.Suffix = t.Schema, t.Prefix, t.Suffix
+	spec.ColumnTypes = t.ColumnTypes
+	if t.Indexes != nil {
+		spec.Indexes = t.Indexes
+	}
+	return spec
+}
+
+// defaultTables are loaded when neither the config file nor LOAD_* say
+// otherwise.
+var defaultTables = map[string]bool{"simples": true, "moti": true, "quals": true}
+
+// File is the config file (CONFIG_FILE or --config), in JSON:
+//
+//	{"tables": [
+//	  {"name": "empresa", "schema": "rfb", "column_types": {"capital_social": "numeric"}},
+//	  {"name": "estabelecimento", "filter": {"uf": ["SP", "RJ"]}, "file_workers": 4}
+//	]}
+//
+// Listed tables are loaded, unless "enabled" is false; the others are not.
+type File struct {
+	Tables []FileTable `json:"tables"`
+}
+
+type FileTable struct {
+	Name        string              `json:"name"`
+	Enabled     *bool               `json:"enabled,omitempty"`
+	Indexes     []FileIndex         `json:"indexes,omitempty"`
+	ColumnTypes map[string]string   `json:"column_types,omitempty"`
+	Filter      map[string][]string `json:"filter,omitempty"`
+	Schema      string              `json:"schema,omitempty"`
+	FileWorkers int                 `json:"file_workers,omitempty"`
+}
+
+// FileIndex is an index on Columns; Name defaults to <table>_<columns>.
+type FileIndex struct {
+	Name    string   `json:"name,omitempty"`
+	Columns []string `json:"columns"`
+}
+
+// ReadFile parses a config file. Unknown fields are an error, so a typo
+// doesn't silently drop an option.
+func ReadFile(path string) (File, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return File{}, fmt.Errorf("arquivo de configuração: %w", err)
+	}
+	defer fh.Close()
+	dec := json.NewDecoder(fh)
+	dec.DisallowUnknownFields()
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return File{}, fmt.Errorf("arquivo de configuração %s: %w", path, err)
+	}
+	return f, nil
+}
+
+var reIdent = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// resolveTables builds the table list of the registry. Precedence, lowest
+// first: defaultTables, the config file, LOAD_<TABLE> and the --tables flag
+// (only the listed tables).
+func resolveTables(p *parser, f File, only []string) []TableConfig {
+	byName := map[string]*TableConfig{}
+	out := make([]TableConfig, len(loaders.All))
+	for i, s := range loaders.All {
+		out[i] = TableConfig{Name: s.Name, Enabled: defaultTables[s.Name]}
+		byName[s.Name] = &out[i]
+	}
+
+	if len(f.Tables) > 0 {
+		for i := range out {
+			out[i].Enabled = false
+		}
+	}
+	seen := map[string]bool{}
+	for _, ft := range f.Tables {
+		name := strings.ToLower(strings.TrimSpace(ft.Name))
+		tc, ok := byName[name]
+		if !ok {
+			p.problem("tabela desconhecida no arquivo de configuração: %q (use %s)", ft.Name, strings.Join(TableNames(), ", "))
+			continue
+		}
+		if seen[name] {
+			p.problem("tabela %s repetida no arquivo de configuração", name)
+			continue
+		}
+		seen[name] = true
+		if err := applyFileTable(tc, ft); err != nil {
+			p.problem("tabela %s: %v", name, err)
+		}
+	}
+
+	for i := range out {
+		k := "LOAD_" + strings.ToUpper(out[i].Name)
+		if strings.TrimSpace(p.getenv(k)) != "" {
+			out[i].Enabled = p.bool(k, out[i].Enabled)
+		}
+	}
+
+	if len(only) > 0 {
+		want := map[string]bool{}
+		for _, n := range only {
+			n = strings.ToLower(strings.TrimSpace(n))
+			if n == "" {
+				continue
+			}
+			if _, ok := byName[n]; !ok {
+				p.problem("tabela desconhecida em --tables: %q (use %s)", n, strings.Join(TableNames(), ", "))
+				continue
+			}
+			want[n] = true
+		}
+		for i := range out {
+			out[i].Enabled = want[out[i].Name]
+		}
+	}
+	return out
+}
+
+func applyFileTable(tc *TableConfig, ft FileTable) error {
+	spec, _ := loaders.Lookup(tc.Name)
+	tc.Enabled = ft.Enabled == nil || *ft.Enabled
+
+	if ft.Schema != "" && !reIdent.MatchString(ft.Schema) {
+		return fmt.Errorf("schema inválido: %q", ft.Schema)
+	}
+	tc.Schema = ft.Schema
+
+	if ft.FileWorkers < 0 {
+		return fmt.Errorf("file_workers inválido: %d", ft.FileWorkers)
+	}
+	tc.FileWorkers = ft.FileWorkers
+
+	for col, typ := range ft.ColumnTypes {
+		if !spec.HasColumn(col) {
+			return fmt.Errorf("column_types: coluna desconhecida %q", col)
+		}
+		if !loaders.ValidColumnType(typ) {
+			return fmt.Errorf("column_types: tipo não suportado para %s: %q", col, typ)
+		}
+	}
+	tc.ColumnTypes = ft.ColumnTypes
+
+	for col, vals := range ft.Filter {
+		if !spec.HasColumn(col) {
+			return fmt.Errorf("filter: coluna desconhecida %q", col)
+		}
+		if len(vals) == 0 {
+			return fmt.Errorf("filter: nenhum valor para %s", col)
+		}
+	}
+	tc.Filter = ft.Filter
+
+	if ft.Indexes != nil {
+		tc.Indexes = []loaders.Index{}
+		for _, fi := range ft.Indexes {
+			if len(fi.Columns) == 0 {
+				return fmt.Errorf("indexes: índice sem colunas")
+			}
+			for _, col := range fi.Columns {
+				if !spec.HasColumn(col) {
+					return fmt.Errorf("indexes: coluna desconhecida %q", col)
+				}
+			}
+			name := fi.Name
+			if name == "" {
+				name = tc.Name + "_" + strings.Join(fi.Columns, "_")
+			}
+			if !reIdent.MatchString(name) {
+				return fmt.Errorf("indexes: nome inválido %q", name)
+			}
+			tc.Indexes = append(tc.Indexes, loaders.Index{Name: name, Columns: fi.Columns})
+		}
+	}
+	return nil
+}
+
+// TableNames lists the tables of the registry, sorted.
+func TableNames() []string {
+	out := make([]string, 0, len(loaders.All))
+	for _, s := range loaders.All {
+		out = append(out, s.Name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// EnabledTables are the names of the tables to load, in registry order.
+func (c Config) EnabledTables() []string {
+	var out []string
+	for _, t := range c.Tables {
+		if t.Enabled {
+			out = append(out, t.Name)
+		}
+	}
+	return out
+}
+
+// Table returns the config of a table of the registry.
+func (c Config) Table(name string) (TableConfig, bool) {
+	for _, t := range c.Tables {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return TableConfig{}, false
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "rfcnpj.json")
+	if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	return p
+}
+
+func TestLoad_DefaultTables(t *testing.T) {
+	t.Setenv("DAV_LIST_URL_TEMPLATE", "https://example.test/%s/")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if got := strings.Join(cfg.EnabledTables(), ","); got != "simples,moti,quals" {
+		t.Fatalf("unexpected default tables: %s", got)
+	}
+	if len(cfg.Tables) != 10 {
+		t.Fatalf("expected every registry table, got %d", len(cfg.Tables))
+	}
+}
+
+func TestLoadWith_FileEnvAndFlagPrecedence(t *testing.T) {
+	t.Setenv("DAV_LIST_URL_TEMPLATE", "https://example.test/%s/")
+	p := writeConfigFile(t, `{"tables": [
+		{"name": "empresa", "schema": "rfb", "column_types": {"capital_social": "numeric(18,2)"}, "file_workers": 4},
+		{"name": "estabelecimento", "filter": {"uf": ["SP"]}, "indexes": [{"columns": ["uf", "municipio"]}]},
+		{"name": "socios", "enabled": false}
+	]}`)
+	t.Setenv("CONFIG_FILE", p)
+	t.Setenv("LOAD_SOCIOS", "true")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if got := strings.Join(cfg.EnabledTables(), ","); got != "empresa,estabelecimento,socios" {
+		t.Fatalf("unexpected tables: %s", got)
+	}
+	emp, _ := cfg.Table("empresa")
+	spec := emp.Spec()
+	if spec.Schema != "rfb" || spec.ColumnTypes["capital_social"] != "numeric(18,2)" || emp.FileWorkers != 4 {
+		t.Fatalf("empresa options not applied: %+v", emp)
+	}
+	if len(spec.Indexes) != 1 || spec.Indexes[0].Name != "empresa_cnpj" {
+		t.Fatalf("expected the registry index for empresa, got %+v", spec.Indexes)
+	}
+	est, _ := cfg.Table("estabelecimento")
+	if idx := est.Spec().Indexes; len(idx) != 1 || idx[0].Name != "estabelecimento_uf_municipio" {
+		t.Fatalf("expected the file index to replace the default, got %+v", idx)
+	}
+	if len(est.Filter["uf"]) != 1 {
+		t.Fatalf("filter not applied: %+v", est.Filter)
+	}
+
+	cfg, err = LoadWith(Overrides{Tables: []string{"cnae", " Moti "}})
+	if err != nil {
+		t.Fatalf("LoadWith returned error: %v", err)
+	}
+	if got := strings.Join(cfg.EnabledTables(), ","); got != "cnae,moti" {
+		t.Fatalf("--tables must be the only tables, got %s", got)
+	}
+}
+
+func TestLoadWith_RejectsInvalidFile(t *testing.T) {
+	t.Setenv("DAV_LIST_URL_TEMPLATE", "https://example.test/%s/")
+
+	cases := map[string]string{
+		"unknown table":  `{"tables": [{"name": "empresas"}]}`,
+		"unknown field":  `{"tables": [{"name": "empresa", "indices": []}]}`,
+		"unknown column": `{"tables": [{"name": "empresa", "filter": {"uf": ["SP"]}}]}`,
+		"bad type":       `{"tables": [{"name": "empresa", "column_types": {"capital_social": "money; drop table x"}}]}`,
+		"bad schema":     `{"tables": [{"name": "empresa", "schema": "a b"}]}`,
+		"repeated table": `{"tables": [{"name": "moti"}, {"name": "moti"}]}`,
+		"not json":       `tables: [moti]`,
+	}
+	for name, body := range cases {
+		if _, err := LoadWith(Overrides{ConfigFile: writeConfigFile(t, body)}); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if _, err := LoadWith(Overrides{Tables: []string{"nope"}}); err == nil {
+		t.Fatal("expected error for unknown --tables entry")
+	}
+}
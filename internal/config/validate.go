@@ -0,0 +1,352 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/db"
+	"github.com/abriciof/rfcnpj-loader/internal/notify"
+	"github.com/abriciof/rfcnpj-loader/internal/redact"
+	"github.com/abriciof/rfcnpj-loader/internal/timeutil"
+)
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "configuração inválida:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the whole configuration, including that the data
+// directories can be written, and reports every problem at once.
+func (c Config) Validate() error { return c.check(true) }
+
+func (c Config) check(paths bool) error {
+	probs := append([]string(nil), c.problems...)
+	add := func(format string, args ...any) { probs = append(probs, fmt.Sprintf(format, args...)) }
+
+	if strings.TrimSpace(c.DavListURLTemplate) == "" {
+		add("DAV_LIST_URL_TEMPLATE não configurada")
+	} else if strings.Count(c.DavListURLTemplate, "%s") != 1 {
+		add("DAV_LIST_URL_TEMPLATE deve conter %%s uma única vez, no lugar do mês: %q", c.DavListURLTemplate)
+	}
+	if u, err := url.Parse(c.DavBaseDomain); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("DAV_BASE_DOMAIN deve ser uma URL http(s): %q", c.DavBaseDomain)
+	}
+	for _, m := range [][2]string{{"START_MONTH", c.StartMonth}, {"FORCE_MONTH", c.ForceMonth}} {
+		if strings.TrimSpace(m[1]) == "" {
+			continue
+		}
+		if _, err := timeutil.ParseYearMonth(strings.TrimSpace(m[1])); err != nil {
+			add("%s deve estar no formato AAAA-MM: %q", m[0], m[1])
+		}
+	}
+	if c.DatabaseURL == "" {
+		if port, err := strconv.Atoi(c.DBPort); err != nil || port <= 0 || port > 65535 {
+			add("DB_PORT inválida: %q", c.DBPort)
+		}
+	} else if _, err := c.DBOptions().DSN(); err != nil {
+		// o erro de url.Parse repete a URL, com a senha
+		add("%s", redact.String(err.Error()))
+	}
+	if c.DBSSLMode != "" && !contains(db.SSLModes, c.DBSSLMode) {
+		add("DB_SSLMODE inválido: %q (use %s)", c.DBSSLMode, strings.Join(db.SSLModes, ", "))
+	}
+	if (c.DBSSLCert == "") != (c.DBSSLKey == "") {
+		add("DB_SSLCERT e DB_SSLKEY vão juntos (certificado do cliente)")
+	}
+	for _, f := range [][2]string{{"DB_SSLROOTCERT", c.DBSSLRootCert}, {"DB_SSLCERT", c.DBSSLCert}, {"DB_SSLKEY", c.DBSSLKey}} {
+		if f[1] == "" {
+			continue
+		}
+		if fi, err := os.Stat(f[1]); err != nil || fi.IsDir() {
+			add("%s: arquivo não encontrado: %q", f[0], f[1])
+		}
+	}
+	probs = append(probs, c.checkNames()...)
+	if c.DBMaxConns < 2 {
+		add("DB_MAX_CONNS deve ser pelo menos 2 (uma fica com o lock; atual: %d)", c.DBMaxConns)
+	}
+	if c.DBConnectTimeout <= 0 {
+		add("DB_CONNECT_TIMEOUT_SECONDS deve ser maior que zero (atual: %d)", c.DBConnectTimeout)
+	}
+	if c.DBConnectRetries < 0 || c.DBConnectRetryDelay < 0 {
+		add("DB_CONNECT_RETRIES e DB_CONNECT_RETRY_DELAY_SECONDS não podem ser negativos")
+	}
+
+	for _, w := range []struct {
+		key string
+		n   int
+	}{
+		{"DOWNLOAD_WORKERS", c.DownloadWorkers},
+		{"EXTRACT_WORKERS", c.ExtractWorkers},
+		{"TABLE_WORKERS", c.TableWorkers},
+		{"FILE_WORKERS", c.FileWorkers},
+	} {
+		if w.n <= 0 {
+			add("%s deve ser maior que zero (atual: %d)", w.key, w.n)
+		}
+	}
+	if c.ExtractMaxEntryBytes < 0 || c.ExtractMaxTotalBytes < 0 || c.ExtractMaxRatio < 0 {
+		add("os limites EXTRACT_MAX_* não podem ser negativos")
+	}
+	if c.LockWaitTimeout < 0 {
+		add("LOCK_WAIT_TIMEOUT_SECONDS não pode ser negativo (atual: %d)", c.LockWaitTimeout)
+	}
+	if need := c.poolDemand(); c.TableWorkers > 0 && c.FileWorkers > 0 && c.DBMaxConns >= 2 && need > c.DBMaxConns {
+		add("TABLE_WORKERS e FILE_WORKERS pedem até %d conexões (mais uma do lock), acima de DB_MAX_CONNS=%d: reduza os workers ou aumente o pool", need-1, c.DBMaxConns)
+	}
+
+	for _, e := range []struct {
+		key, value string
+		allowed    []string
+	}{
+		{"SCAN_UNCLASSIFIED", c.ScanUnclassified, []string{"warn", "fail"}},
+		{"SNIFF_MISMATCH", c.SniffMismatch, []string{"fail", "warn"}},
+		{"LAYOUT_DRIFT", c.LayoutDrift, []string{"warn", "fail", "ignore"}},
+		{"LOCK_MODE", c.LockMode, []string{"wait", "skip", "fail"}},
+		{"MAIL_ATTACH_REPORT", c.MailAttachReport, []string{"none", "json", "csv"}},
+		{"SMTP_TLS", c.SMTPTLS, []string{"", "none", "starttls", "implicit"}},
+		{"SMTP_AUTH", c.SMTPAuth, []string{"", "none", "plain", "login", "cram-md5"}},
+		{"LOG_LEVEL", strings.ToLower(strings.TrimSpace(c.LogLevel)), []string{"debug", "info", "warn", "warning", "error"}},
+	} {
+		if !contains(e.allowed, e.value) {
+			add("%s inválido: %q (use %s)", e.key, e.value, strings.Join(choices(e.allowed), ", "))
+		}
+	}
+	if _, ok := timeutil.NormalizeLocale(c.Locale); !ok {
+		add("LOCALE não suportado: %q (use pt-BR ou en)", c.Locale)
+	}
+	if v := strings.TrimSpace(c.ReportUTCOffset); v != "" {
+		if _, err := time.Parse("-07:00", v); err != nil {
+			add("REPORT_UTC_OFFSET deve estar no formato -03:00: %q", c.ReportUTCOffset)
+		}
+	}
+	if _, err := notify.ParseKinds(c.NotifyEvents); err != nil {
+		add("NOTIFY_EVENTS inválido: %v", err)
+	}
+	probs = append(probs, c.checkSMTP()...)
+
+	if paths {
+		probs = append(probs, c.checkPaths()...)
+	}
+	if len(probs) > 0 {
+		return &ValidationError{Problems: probs}
+	}
+	return nil
+}
+
+var reAffix = regexp.MustCompile(`^[a-z0-9_]*$`)
+
+// checkNames checks TARGET_SCHEMA, TABLE_PREFIX and TABLE_SUFFIX and that the
+// resulting table and index names fit in a Postgres identifier.
+func (c Config) checkNames() []string {
+	var probs []string
+	if c.TargetSchema != "" && !reIdent.MatchString(c.TargetSchema) {
+		probs = append(probs, fmt.Sprintf("TARGET_SCHEMA inválido: %q (use letras minúsculas, números e _)", c.TargetSchema))
+	}
+	if !reAffix.MatchString(c.TablePrefix) || (c.TablePrefix != "" && !reIdent.MatchString(c.TablePrefix)) {
+		probs = append(probs, fmt.Sprintf("TABLE_PREFIX inválido: %q (use letras minúsculas, números e _, sem começar com número)", c.TablePrefix))
+	}
+	if !reAffix.MatchString(c.TableSuffix) {
+		probs = append(probs, fmt.Sprintf("TABLE_SUFFIX inválido: %q (use letras minúsculas, números e _)", c.TableSuffix))
+	}
+	for _, t := range c.Tables {
+		staged := t.Spec().Staging()
+		names := []string{staged.Relation()}
+		for _, idx := range staged.Indexes {
+			names = append(names, staged.IndexName(idx))
+		}
+		for _, n := range names {
+			if len(n) > maxIdentLen {
+				probs = append(probs, fmt.Sprintf("nome %q passa de %d caracteres: encurte TABLE_PREFIX/TABLE_SUFFIX", n, maxIdentLen))
+			}
+		}
+	}
+	return probs
+}
+
+// maxIdentLen is the longest identifier Postgres keeps (NAMEDATALEN-1).
+const maxIdentLen = 63
+
+// poolDemand is the number of connections a run can hold at once: the lock
+// and one per file loaded by the TABLE_WORKERS tables with the most file
+// workers.
+func (c Config) poolDemand() int {
+	var workers []int
+	for _, t := range c.Tables {
+		if !t.Enabled {
+			continue
+		}
+		w := c.FileWorkers
+		if t.FileWorkers > 0 {
+			w = t.FileWorkers
+		}
+		workers = append(workers, w)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(workers)))
+	n := 1
+	for i, w := range workers {
+		if i == c.TableWorkers {
+			break
+		}
+		n += w
+	}
+	return n
+}
+
+// checkSMTP requires a complete e-mail setup once any of it is set: the host
+// and port have defaults, so only the other settings count.
+func (c Config) checkSMTP() []string {
+	set := c.MailTo != "" || c.SMTPUser != "" || c.SMTPPass != "" || c.MailFrom != "" || c.MailCc != "" || c.MailBcc != ""
+	if !set {
+		return nil
+	}
+	var probs []string
+	if strings.TrimSpace(c.MailTo) == "" {
+		probs = append(probs, "e-mail configurado pela metade: falta MAIL_TO")
+	}
+	if strings.TrimSpace(c.SMTPHost) == "" {
+		probs = append(probs, "e-mail configurado pela metade: falta SMTP_HOST")
+	}
+	if c.SMTPPort <= 0 || c.SMTPPort > 65535 {
+		probs = append(probs, fmt.Sprintf("SMTP_PORT inválida: %d", c.SMTPPort))
+	}
+	if strings.TrimSpace(c.MailFrom) == "" && strings.TrimSpace(c.SMTPUser) == "" {
+		probs = append(probs, "e-mail configurado pela metade: falta MAIL_FROM ou SMTP_USER")
+	}
+	if c.SMTPAuth != "none" {
+		user, pass := strings.TrimSpace(c.SMTPUser) != "", strings.TrimSpace(c.SMTPPass) != ""
+		if user != pass || (c.SMTPAuth != "" && !user) {
+			probs = append(probs, "e-mail configurado pela metade: SMTP_USER e SMTP_PASS vão juntos (ou use SMTP_AUTH=none)")
+		}
+	}
+	return probs
+}
+
+// checkPaths checks that the directories the run writes to can be created and
+// written, without creating them.
+func (c Config) checkPaths() []string {
+	var probs []string
+	for _, d := range []struct{ key, path string }{
+		{"OUTPUT_FILES_PATH", c.OutputFilesPath},
+		{"EXTRACTED_FILES_PATH", c.ExtractedFilesPath},
+		{"REPORT_DIR", c.ReportDir},
+	} {
+		if d.path == "" {
+			if d.key != "REPORT_DIR" {
+				probs = append(probs, d.key+" não configurado")
+			}
+			continue
+		}
+		if err := writableDir(d.path); err != nil {
+			probs = append(probs, fmt.Sprintf("%s: %v", d.key, err))
+		}
+	}
+	if c.TemplatesDir != "" {
+		if fi, err := os.Stat(c.TemplatesDir); err != nil || !fi.IsDir() {
+			probs = append(probs, fmt.Sprintf("TEMPLATES_DIR não é um diretório: %q", c.TemplatesDir))
+		}
+	}
+	return probs
+}
+
+// writableDir checks that dir, or the nearest parent that exists, is a
+// directory where files can be created.
+func writableDir(dir string) error {
+	p := filepath.Clean(dir)
+	for {
+		fi, err := os.Stat(p)
+		if err == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("%s não é um diretório", p)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return fmt.Errorf("%s não existe", dir)
+		}
+		p = parent
+	}
+	f, err := os.CreateTemp(p, ".rfcnpj-write-check-*")
+	if err != nil {
+		return fmt.Errorf("sem permissão de escrita em %s", p)
+	}
+	name := f.Name()
+	_ = f.Close()
+	return os.Remove(name)
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// choices names the allowed values; "" is the auto of SMTP_TLS and SMTP_AUTH.
+func choices(list []string) []string {
+	out := make([]string, len(list))
+	for i, s := range list {
+		if s == "" {
+			s = "auto"
+		}
+		out[i] = s
+	}
+	return out
+}
+
+// Settings are the values read from the environment, in reading order.
+func (c Config) Settings() []Setting { return c.settings }
+
+// Secrets are the secret values that were configured (not defaults), and the
+// password of DATABASE_URL, to be hidden from logs and messages. A value
+// found inside a setting that isn't secret (DB_PASSWORD=postgres with
+// DB_USER=postgres or DB_HOST=postgres) is left out: hiding it would mask
+// that setting, and table names and hosts, everywhere. It is still hidden in
+// URLs and password= of connection strings.
+func (c Config) Secrets() []string {
+	var public []string
+	for _, s := range c.settings {
+		if !s.Secret && s.Value != "" {
+			public = append(public, strings.ToLower(s.Value))
+		}
+	}
+	var out []string
+	add := func(v string) {
+		lv := strings.ToLower(strings.TrimSpace(v))
+		for _, p := range public {
+			if lv != "" && strings.Contains(p, lv) {
+				return
+			}
+		}
+		out = append(out, v)
+	}
+	for _, s := range c.settings {
+		if !s.Secret || s.Default {
+			continue
+		}
+		add(s.Value)
+		if u, err := url.Parse(s.Value); err == nil && u.User != nil {
+			if pw, ok := u.User.Password(); ok {
+				add(pw)
+			}
+		}
+	}
+	return out
+}
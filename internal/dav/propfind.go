@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
@@ -52,6 +55,60 @@ type Item struct {
 }
 
 func (c *Client) ListZips(ctx context.Context, listURL string) ([]Item, error) {
+	ms, err := c.propfind(ctx, listURL)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		href := strings.TrimSpace(r.Href)
+		if !strings.HasSuffix(strings.ToLower(href), ".zip") {
+			continue
+		}
+
+		var chosen Prop
+		for _, ps := range r.Propstat {
+			if strings.Contains(ps.Status, "200") {
+				chosen = ps.Prop
+				break
+			}
+		}
+
+		items = append(items, Item{
+			Href:          href,
+			ContentLength: chosen.GetContentLength,
+			ContentType:   chosen.GetContentType,
+			LastModified:  chosen.GetLastModified,
+		})
+	}
+
+	return items, nil
+}
+
+// reMonth is a month folder of the share (YYYY-MM).
+var reMonth = regexp.MustCompile(`^\d{4}-\d{2}$`)
+
+// ListMonths lists the month folders (YYYY-MM) published under rootURL, the
+// folder that holds them, in ascending order.
+func (c *Client) ListMonths(ctx context.Context, rootURL string) ([]string, error) {
+	ms, err := c.propfind(ctx, rootURL)
+	if err != nil {
+		return nil, err
+	}
+	var months []string
+	for _, r := range ms.Responses {
+		name := path.Base(strings.TrimRight(strings.TrimSpace(r.Href), "/"))
+		if reMonth.MatchString(name) {
+			months = append(months, name)
+		}
+	}
+	sort.Strings(months)
+	return months, nil
+}
+
+// propfind lists listURL with Depth 1.
+func (c *Client) propfind(ctx context.Context, listURL string) (MultiStatus, error) {
 	body := `<?xml version="1.0"?>
 <d:propfind xmlns:d="DAV:">
   <d:prop>
@@ -63,54 +120,30 @@ func (c *Client) ListZips(ctx context.Context, listURL string) ([]Item, error) {
 
 	req, err := http.NewRequestWithContext(ctx, "PROPFIND", listURL, bytes.NewBufferString(body))
 	if err != nil {
-		return nil, err
+		return MultiStatus{}, err
 	}
 	req.Header.Set("Depth", "1")
 	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
 
 	resp, err := c.http.Do(req)
 	if err != nil {
-		return nil, err
+		return MultiStatus{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		b, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		return nil, fmt.Errorf("PROPFIND falhou (%d): %s", resp.StatusCode, strings.TrimSpace(string(b)))
+		return MultiStatus{}, fmt.Errorf("PROPFIND falhou (%d): %s", resp.StatusCode, strings.TrimSpace(string(b)))
 	}
 
 	raw, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return MultiStatus{}, err
 	}
 
 	var ms MultiStatus
 	if err := xml.Unmarshal(raw, &ms); err != nil {
-		return nil, fmt.Errorf("erro parse XML PROPFIND: %w", err)
+		return MultiStatus{}, fmt.Errorf("erro parse XML PROPFIND: %w", err)
 	}
-
-	items := make([]Item, 0, len(ms.Responses))
-	for _, r := range ms.Responses {
-		href := strings.TrimSpace(r.Href)
-		if !strings.HasSuffix(strings.ToLower(href), ".zip") {
-			continue
-		}
-
-		var chosen Prop
-		for _, ps := range r.Propstat {
-			if strings.Contains(ps.Status, "200") {
-				chosen = ps.Prop
-				break
-			}
-		}
-
-		items = append(items, Item{
-			Href:          href,
-			ContentLength: chosen.GetContentLength,
-			ContentType:   chosen.GetContentType,
-			LastModified:  chosen.GetLastModified,
-		})
-	}
-
-	return items, nil
+	return ms, nil
 }
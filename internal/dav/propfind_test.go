@@ -89,3 +89,33 @@ func TestListZips_ReturnsOnlyZipFiles(t *testing.T) {
 	}
 }
 
+
+func TestListMonths_SortedMonthFolders(t *testing.T) {
+	t.Parallel()
+
+	xmlBody := `<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:">
+  <d:response><d:href>/dav/CNPJ/</d:href></d:response>
+  <d:response><d:href>/dav/CNPJ/2026-02/</d:href></d:response>
+  <d:response><d:href>/dav/CNPJ/temp/</d:href></d:response>
+  <d:response><d:href>/dav/CNPJ/2025-12/</d:href></d:response>
+  <d:response><d:href>/dav/CNPJ/LAYOUT.pdf</d:href></d:response>
+</d:multistatus>`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PROPFIND" || r.Header.Get("Depth") != "1" {
+			t.Errorf("unexpected request %s depth=%q", r.Method, r.Header.Get("Depth"))
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		_, _ = w.Write([]byte(xmlBody))
+	}))
+	defer srv.Close()
+
+	months, err := NewClient().ListMonths(context.Background(), srv.URL+"/dav/CNPJ/")
+	if err != nil {
+		t.Fatalf("ListMonths returned error: %v", err)
+	}
+	if strings.Join(months, ",") != "2025-12,2026-02" {
+		t.Fatalf("unexpected months %v", months)
+	}
+}
@@ -0,0 +1,61 @@
+package davtest
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// WriteZip creates a zip archive at zipPath with the given entries
+// (entry name -> content). Parent directories are created as needed.
+func WriteZip(zipPath string, entries map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(zipPath), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zw := zip.NewWriter(f)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(entries[name])); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// WriteMonth writes one zip per key of zips into root/<month>/, all with the
+// given modification time (zero keeps the current time).
+func WriteMonth(root, month string, zips map[string]map[string]string, modTime time.Time) error {
+	dir := filepath.Join(root, month)
+	for name, entries := range zips {
+		p := filepath.Join(dir, name)
+		if err := WriteZip(p, entries); err != nil {
+			return err
+		}
+		if !modTime.IsZero() {
+			if err := os.Chtimes(p, modTime, modTime); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
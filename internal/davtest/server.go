@@ -0,0 +1,462 @@
+// Package davtest serves a fixture directory tree as a Nextcloud-style public
+// WebDAV share, so the pipeline can be exercised end to end without internet.
+//
+// The fixture root mirrors the share layout below BasePath, one directory per
+// month:
+//
+//	root/2026-01/Empresas0.zip
+//	root/2026-01/Simples.zip
+//	root/2026-02/...
+package davtest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultToken    = "testshare"
+	DefaultBasePath = "Dados/Cadastros/CNPJ"
+)
+
+type Options struct {
+	// Token is the public share token used in the DAV path.
+	Token string
+	// BasePath is the folder inside the share that holds the month folders.
+	BasePath string
+	// Months limits which month folders are published. Nil publishes every
+	// month folder found in the fixture root.
+	Months []string
+	// Latency is added before every response.
+	Latency time.Duration
+}
+
+// Fault describes an injected failure. A fault matches requests whose method
+// equals Method (any method when empty) and whose path contains PathContains.
+// Times limits how many requests are affected (0 means every matching request).
+type Fault struct {
+	Method       string
+	PathContains string
+	Times        int
+
+	// Status answers with this HTTP status code.
+	Status int
+	// Reset closes the TCP connection abruptly (RST) after AfterBytes bytes of
+	// the response body have been written.
+	Reset      bool
+	AfterBytes int64
+	// Latency delays matching requests by this extra duration.
+	Latency time.Duration
+}
+
+type Server struct {
+	*httptest.Server
+
+	root string
+
+	mu       sync.Mutex
+	opts     Options
+	faults   []*faultState
+	requests []Request
+}
+
+// Request records a request served (or failed) by the fake share.
+type Request struct {
+	Method string
+	Path   string
+	Depth  string
+	Range  string
+}
+
+type faultState struct {
+	Fault
+	hits int
+}
+
+// NewServer starts a fake DAV share serving the fixture tree at root.
+func NewServer(root string, opts Options) *Server {
+	if opts.Token == "" {
+		opts.Token = DefaultToken
+	}
+	if opts.BasePath == "" {
+		opts.BasePath = DefaultBasePath
+	}
+	opts.BasePath = strings.Trim(opts.BasePath, "/")
+
+	s := &Server{root: root, opts: opts}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// BaseDomain is the value to use as DAV_BASE_DOMAIN.
+func (s *Server) BaseDomain() string { return s.URL }
+
+// ListURLTemplate is the value to use as DAV_LIST_URL_TEMPLATE.
+func (s *Server) ListURLTemplate() string {
+	return s.URL + s.sharePrefix() + "/" + s.opts.BasePath + "/%s/"
+}
+
+// MonthURL returns the listing URL for one month.
+func (s *Server) MonthURL(month string) string {
+	return fmt.Sprintf(s.ListURLTemplate(), month)
+}
+
+// SetMonths changes which months are published. Nil publishes all.
+func (s *Server) SetMonths(months ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts.Months = months
+}
+
+// SetLatency changes the latency added to every response.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts.Latency = d
+}
+
+// InjectFault registers a fault. Faults are evaluated in registration order
+// and the first active match wins.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &faultState{Fault: f})
+}
+
+// ClearFaults removes every registered fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns a copy of the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Request, len(s.requests))
+	copy(out, s.requests)
+	return out
+}
+
+func (s *Server) sharePrefix() string {
+	return "/public.php/dav/files/" + s.opts.Token
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Depth:  r.Header.Get("Depth"),
+		Range:  r.Header.Get("Range"),
+	})
+	latency := s.opts.Latency
+	fault := s.matchFault(r)
+	s.mu.Unlock()
+
+	if fault != nil {
+		latency += fault.Latency
+	}
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if fault != nil {
+		switch {
+		case fault.Status != 0:
+			http.Error(w, http.StatusText(fault.Status), fault.Status)
+			return
+		case fault.Reset:
+			s.serveWithReset(w, r, fault.AfterBytes)
+			return
+		}
+	}
+
+	s.serve(w, r)
+}
+
+// matchFault must be called with s.mu held.
+func (s *Server) matchFault(r *http.Request) *Fault {
+	for _, f := range s.faults {
+		if f.Method != "" && !strings.EqualFold(f.Method, r.Method) {
+			continue
+		}
+		if f.PathContains != "" && !strings.Contains(r.URL.Path, f.PathContains) {
+			continue
+		}
+		if f.Times > 0 && f.hits >= f.Times {
+			continue
+		}
+		f.hits++
+		fault := f.Fault
+		return &fault
+	}
+	return nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	rel, ok := s.resolve(r.URL.Path)
+	if !ok {
+		writeNotFound(w, r.URL.Path)
+		return
+	}
+	fsPath := filepath.Join(s.root, filepath.FromSlash(rel))
+	st, err := os.Stat(fsPath)
+	if err != nil {
+		writeNotFound(w, r.URL.Path)
+		return
+	}
+
+	switch r.Method {
+	case "PROPFIND":
+		s.propfind(w, r, rel, fsPath, st)
+	case http.MethodGet, http.MethodHead:
+		if st.IsDir() {
+			http.Error(w, "directory listing not supported", http.StatusMethodNotAllowed)
+			return
+		}
+		f, err := os.Open(fsPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", contentType(fsPath))
+		w.Header().Set("ETag", etag(st))
+		http.ServeContent(w, r, st.Name(), st.ModTime(), f)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PROPFIND")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// resolve maps a request path to a slash separated path relative to the
+// fixture root, applying the published months filter.
+func (s *Server) resolve(p string) (string, bool) {
+	prefix := s.sharePrefix() + "/" + s.opts.BasePath
+	if p != prefix && !strings.HasPrefix(p, prefix+"/") {
+		return "", false
+	}
+	rel := strings.Trim(path.Clean("/"+strings.TrimPrefix(p, prefix)), "/")
+	if rel == "" {
+		return "", true
+	}
+
+	month := strings.SplitN(rel, "/", 2)[0]
+	if !s.published(month) {
+		return "", false
+	}
+	return rel, true
+}
+
+func (s *Server) published(month string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.Months == nil {
+		return true
+	}
+	for _, m := range s.opts.Months {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) propfind(w http.ResponseWriter, r *http.Request, rel, fsPath string, st os.FileInfo) {
+	depth := r.Header.Get("Depth")
+	switch depth {
+	case "0", "1":
+	case "", "infinity":
+		// Nextcloud rejects infinite depth on public shares.
+		http.Error(w, "Depth infinity is not supported", http.StatusForbidden)
+		return
+	default:
+		http.Error(w, "invalid Depth header", http.StatusBadRequest)
+		return
+	}
+	_, _ = io.Copy(io.Discard, r.Body)
+
+	href := s.sharePrefix() + "/" + s.opts.BasePath
+	if rel != "" {
+		href += "/" + rel
+	}
+
+	responses := []davResponse{s.davEntry(href, st)}
+	if depth == "1" && st.IsDir() {
+		entries, err := os.ReadDir(fsPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		for _, e := range entries {
+			if rel == "" && e.IsDir() && !s.published(e.Name()) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			responses = append(responses, s.davEntry(href+"/"+e.Name(), info))
+		}
+	}
+
+	out, err := xml.MarshalIndent(davMultiStatus{
+		XMLNSD:    "DAV:",
+		XMLNSS:    "http://sabredav.org/ns",
+		XMLNSOC:   "http://owncloud.org/ns",
+		XMLNSNC:   "http://nextcloud.org/ns",
+		Responses: responses,
+	}, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(out)
+}
+
+func (s *Server) davEntry(href string, st os.FileInfo) davResponse {
+	prop := davProp{
+		LastModified: st.ModTime().UTC().Format(http.TimeFormat),
+		ETag:         etag(st),
+	}
+	if st.IsDir() {
+		href += "/"
+		prop.ResourceType = &davResourceType{Collection: &struct{}{}}
+	} else {
+		size := st.Size()
+		prop.ContentLength = &size
+		prop.ContentType = contentType(st.Name())
+		prop.ResourceType = &davResourceType{}
+	}
+	return davResponse{
+		Href: href,
+		Propstat: davPropstat{
+			Prop:   prop,
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+}
+
+// serveWithReset writes the response headers and up to afterBytes of the body,
+// then aborts the TCP connection with a RST.
+func (s *Server) serveWithReset(w http.ResponseWriter, r *http.Request, afterBytes int64) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		size int64
+		body io.Reader = strings.NewReader("")
+	)
+	if rel, ok := s.resolve(r.URL.Path); ok && r.Method == http.MethodGet {
+		fsPath := filepath.Join(s.root, filepath.FromSlash(rel))
+		if f, err := os.Open(fsPath); err == nil {
+			defer f.Close()
+			if st, err := f.Stat(); err == nil && !st.IsDir() {
+				size = st.Size()
+				body = io.LimitReader(f, afterBytes)
+			}
+		}
+	}
+
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer abort(conn)
+
+	if afterBytes <= 0 {
+		return
+	}
+	fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\nContent-Type: application/zip\r\n\r\n", size)
+	_, _ = io.Copy(buf, body)
+	_ = buf.Flush()
+}
+
+func abort(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+func writeNotFound(w http.ResponseWriter, p string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<d:error xmlns:d="DAV:" xmlns:s="http://sabredav.org/ns">
+  <s:exception>Sabre\DAV\Exception\NotFound</s:exception>
+  <s:message>File with name %s could not be located</s:message>
+</d:error>`, xmlEscape(p))
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+func contentType(name string) string {
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		return "application/zip"
+	}
+	return "application/octet-stream"
+}
+
+func etag(st os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, st.ModTime().UnixNano(), st.Size())
+}
+
+type davMultiStatus struct {
+	XMLName   xml.Name      `xml:"d:multistatus"`
+	XMLNSD    string        `xml:"xmlns:d,attr"`
+	XMLNSS    string        `xml:"xmlns:s,attr"`
+	XMLNSOC   string        `xml:"xmlns:oc,attr"`
+	XMLNSNC   string        `xml:"xmlns:nc,attr"`
+	Responses []davResponse `xml:"d:response"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"d:href"`
+	Propstat davPropstat `xml:"d:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"d:prop"`
+	Status string  `xml:"d:status"`
+}
+
+type davProp struct {
+	LastModified  string           `xml:"d:getlastmodified"`
+	ContentLength *int64           `xml:"d:getcontentlength,omitempty"`
+	ContentType   string           `xml:"d:getcontenttype,omitempty"`
+	ResourceType  *davResourceType `xml:"d:resourcetype"`
+	ETag          string           `xml:"d:getetag"`
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"d:collection,omitempty"`
+}
@@ -0,0 +1,169 @@
+package davtest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/dav"
+	"github.com/abriciof/rfcnpj-loader/internal/downloader"
+)
+
+func newFixture(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := WriteMonth(root, "2026-01", map[string]map[string]string{
+		"Simples.zip": {"F.K03200$W.SIMPLES.CSV.D60110": `"00000000";"N";"00000000";"00000000";"N";"00000000";"00000000"` + "\n"},
+		"Motivos.zip": {"F.K03200$Z.D60110.MOTICSV": `"00";"SEM MOTIVO"` + "\n"},
+	}, time.Time{}); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	if err := WriteMonth(root, "2026-02", map[string]map[string]string{
+		"Motivos.zip": {"F.K03200$Z.D60210.MOTICSV": `"00";"SEM MOTIVO"` + "\n"},
+	}, time.Time{}); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	return root
+}
+
+func TestServer_PropfindDepth1ListsZips(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(newFixture(t), Options{})
+	defer srv.Close()
+
+	items, err := dav.NewClient().ListZips(context.Background(), srv.MonthURL("2026-01"))
+	if err != nil {
+		t.Fatalf("ListZips returned error: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 zips, got %d: %+v", len(items), items)
+	}
+	for _, it := range items {
+		if it.ContentLength <= 0 {
+			t.Fatalf("expected content length for %s", it.Href)
+		}
+		if it.LastModified == "" {
+			t.Fatalf("expected last modified for %s", it.Href)
+		}
+		if !strings.HasPrefix(it.Href, "/public.php/dav/files/"+DefaultToken+"/") {
+			t.Fatalf("unexpected href: %s", it.Href)
+		}
+	}
+}
+
+func TestServer_PropfindDepth0(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(newFixture(t), Options{})
+	defer srv.Close()
+
+	req, _ := http.NewRequest("PROPFIND", srv.MonthURL("2026-01"), nil)
+	req.Header.Set("Depth", "0")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("PROPFIND failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d", resp.StatusCode)
+	}
+	if strings.Count(string(body), "<d:response>") != 1 {
+		t.Fatalf("expected only the collection itself, got:\n%s", body)
+	}
+}
+
+func TestServer_UnpublishedMonthIsNotFound(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(newFixture(t), Options{Months: []string{"2026-01"}})
+	defer srv.Close()
+
+	if _, err := dav.NewClient().ListZips(context.Background(), srv.MonthURL("2026-02")); err == nil {
+		t.Fatal("expected error for unpublished month")
+	}
+
+	srv.SetMonths("2026-01", "2026-02")
+	if _, err := dav.NewClient().ListZips(context.Background(), srv.MonthURL("2026-02")); err != nil {
+		t.Fatalf("expected month to be published, got: %v", err)
+	}
+}
+
+func TestServer_GetWithRange(t *testing.T) {
+	t.Parallel()
+
+	root := newFixture(t)
+	srv := NewServer(root, Options{})
+	defer srv.Close()
+
+	want, err := os.ReadFile(filepath.Join(root, "2026-01", "Simples.zip"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.MonthURL("2026-01")+"Simples.zip", nil)
+	req.Header.Set("Range", "bytes=4-9")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d", resp.StatusCode)
+	}
+	if string(got) != string(want[4:10]) {
+		t.Fatalf("unexpected range content")
+	}
+}
+
+func TestServer_FaultStatusAndReset(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(newFixture(t), Options{})
+	defer srv.Close()
+
+	srv.InjectFault(Fault{Method: "PROPFIND", Status: http.StatusServiceUnavailable, Times: 1})
+	if _, err := dav.NewClient().ListZips(context.Background(), srv.MonthURL("2026-01")); err == nil {
+		t.Fatal("expected injected 503 to fail the listing")
+	}
+	if _, err := dav.NewClient().ListZips(context.Background(), srv.MonthURL("2026-01")); err != nil {
+		t.Fatalf("fault should only apply once, got: %v", err)
+	}
+
+	srv.InjectFault(Fault{Method: http.MethodGet, PathContains: "Simples.zip", Reset: true, AfterBytes: 8})
+	items, err := dav.NewClient().ListZips(context.Background(), srv.MonthURL("2026-01"))
+	if err != nil {
+		t.Fatalf("ListZips returned error: %v", err)
+	}
+	out := t.TempDir()
+	d := downloader.NewDAVDownloader(srv.BaseDomain(), out, 1, true)
+	if err := d.DownloadAll(context.Background(), items); err == nil {
+		t.Fatal("expected reset connection to fail the download")
+	}
+	if _, err := os.Stat(filepath.Join(out, "Simples.zip")); err == nil {
+		t.Fatal("truncated download must not be renamed to the final name")
+	}
+}
+
+func TestServer_Latency(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(newFixture(t), Options{Latency: 50 * time.Millisecond})
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := dav.NewClient().ListZips(ctx, srv.MonthURL("2026-01")); err == nil {
+		t.Fatal("expected latency to exceed the context deadline")
+	}
+}
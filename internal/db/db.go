@@ -4,25 +4,154 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/abriciof/rfcnpj-loader/internal/redact"
 )
 
-func OpenSQL(ctx context.Context, host, port, user, pass, name string) (*sql.DB, error) {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", user, pass, host, port, name)
+// DefaultMaxConns is the pool size when Options.MaxConns is not set. The
+// advisory lock keeps one connection for the whole run and each file being
+// loaded uses another.
+const DefaultMaxConns = 10
+
+// Options says how to reach Postgres. URL (DATABASE_URL) is used as is; the
+// libpq-style fields fill the parts it lacks or, for the TLS and session
+// settings, override it. Without URL, the connection is built from Host,
+// Port, User, Password and Name.
+type Options struct {
+	URL string
+
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+
+	// SSLMode is disable, allow, prefer, require, verify-ca or verify-full;
+	// empty keeps the URL's, or disable without URL.
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	ApplicationName string
+	// SearchPath is the search_path of every connection (ex.: "rfb,public").
+	SearchPath string
+
+	// MaxConns is the pool size; 0 uses DefaultMaxConns.
+	MaxConns int
+	// ConnectTimeout bounds each connection attempt; 0 uses 10s.
+	ConnectTimeout time.Duration
+	// ConnectRetries are the attempts after the first one fails, waiting
+	// ConnectRetryDelay (doubled each time, up to 30s) between them.
+	ConnectRetries    int
+	ConnectRetryDelay time.Duration
+}
+
+// SSLModes are the accepted values of Options.SSLMode.
+var SSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// DSN is the postgres:// URL of o.
+func (o Options) DSN() (string, error) {
+	var u *url.URL
+	if strings.TrimSpace(o.URL) != "" {
+		var err error
+		u, err = url.Parse(strings.TrimSpace(o.URL))
+		if err != nil {
+			return "", fmt.Errorf("DATABASE_URL inválida: %w", err)
+		}
+		if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+			return "", fmt.Errorf("DATABASE_URL inválida: esquema %q (use postgres://)", u.Scheme)
+		}
+	} else {
+		u = &url.URL{Scheme: "postgres", Host: net.JoinHostPort(o.Host, o.Port), Path: "/" + o.Name}
+		if o.User != "" {
+			u.User = url.UserPassword(o.User, o.Password)
+		}
+	}
+
+	q := u.Query()
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	set("sslmode", o.SSLMode)
+	if q.Get("sslmode") == "" && o.URL == "" {
+		q.Set("sslmode", "disable")
+	}
+	set("sslrootcert", o.SSLRootCert)
+	set("sslcert", o.SSLCert)
+	set("sslkey", o.SSLKey)
+	set("application_name", o.ApplicationName)
+	set("search_path", o.SearchPath)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Target describes the database of o for logs, without the password.
+func (o Options) Target() string {
+	dsn, err := o.DSN()
+	if err != nil {
+		return ""
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return ""
+	}
+	return u.Host + u.Path
+}
+
+// OpenSQL opens the pool and waits until the database answers. Errors never
+// carry the password.
+func OpenSQL(ctx context.Context, o Options) (*sql.DB, error) {
+	dsn, err := o.DSN()
+	if err != nil {
+		return nil, redact.Error(err)
+	}
 	db, err := sql.Open("pgx", dsn)
 	if err != nil {
-		return nil, err
+		// o erro pode repetir a DSN
+		return nil, redact.Error(err)
+	}
+	maxConns := o.MaxConns
+	if maxConns <= 0 {
+		maxConns = DefaultMaxConns
 	}
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
+	db.SetMaxOpenConns(maxConns)
+	db.SetMaxIdleConns(min(5, maxConns))
 	db.SetConnMaxLifetime(30 * time.Minute)
 
-	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	if err := db.PingContext(ctx2); err != nil {
-		return nil, err
+	timeout := o.ConnectTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	delay := o.ConnectRetryDelay
+	for attempt := 0; ; attempt++ {
+		ctx2, cancel := context.WithTimeout(ctx, timeout)
+		err = db.PingContext(ctx2)
+		cancel()
+		if err == nil {
+			return db, nil
+		}
+		err = redact.Error(err)
+		if attempt >= o.ConnectRetries || ctx.Err() != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		slog.Warn("database connection failed; retrying", "target", o.Target(), "attempt", attempt+1, "retry_in", delay.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			_ = db.Close()
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 30*time.Second)
 	}
-	return db, nil
 }
@@ -27,7 +27,7 @@ func TestOpenSQL_RealIntegration(t *testing.T) {
 		t.Fatal("DB_HOST, DB_PORT, DB_USER, DB_PASSWORD and DB_NAME are required")
 	}
 
-	conn, err := OpenSQL(context.Background(), host, port, user, pass, name)
+	conn, err := OpenSQL(context.Background(), Options{Host: host, Port: port, User: user, Password: pass, Name: name})
 	if err != nil {
 		t.Fatalf("OpenSQL real integration failed: %v", err)
 	}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"time"
+)
+
+// LoaderLockKey is the pg_advisory_lock key of the loader. Advisory locks are
+// scoped to the current database, so two loaders only exclude each other when
+// they target the same one.
+const LoaderLockKey int64 = 0x7266636e706a // "rfcnpj"
+
+// LockKey is the lock key of the loaders that write to schema: LoaderLockKey
+// for the default one. Loaders of different schemas don't exclude each other.
+func LockKey(schema string) int64 {
+	if schema == "" {
+		return LoaderLockKey
+	}
+	h := fnv.New64a()
+	h.Write([]byte("rfcnpj:" + schema))
+	return int64(h.Sum64())
+}
+
+// AdvisoryLock is a session-level advisory lock. It lives on a dedicated
+// connection: the pool could otherwise hand the session that holds it to
+// another query, or close it.
+type AdvisoryLock struct {
+	conn *sql.Conn
+	key  int64
+	held bool
+}
+
+// NewAdvisoryLock reserves a connection for key. The connection is named
+// <application_name>@<hostname> (rfcnpj-loader@<hostname> by default) so
+// other instances can tell who holds the lock.
+func NewAdvisoryLock(ctx context.Context, db *sql.DB, key int64) (*AdvisoryLock, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	const q = `SELECT set_config('application_name', coalesce(nullif(current_setting('application_name'), ''), 'rfcnpj-loader') || '@' || $1, false)`
+	if _, err := conn.ExecContext(ctx, q, host); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &AdvisoryLock{conn: conn, key: key}, nil
+}
+
+// TryAcquire takes the lock if it is free.
+func (l *AdvisoryLock) TryAcquire(ctx context.Context) (bool, error) {
+	var ok bool
+	if err := l.conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&ok); err != nil {
+		return false, err
+	}
+	l.held = ok
+	return ok, nil
+}
+
+// Acquire waits for the lock until ctx is done.
+func (l *AdvisoryLock) Acquire(ctx context.Context) error {
+	if _, err := l.conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, l.key); err != nil {
+		return err
+	}
+	l.held = true
+	return nil
+}
+
+// LockHolder is the session holding an advisory lock.
+type LockHolder struct {
+	PID         int
+	Application string
+	ClientAddr  string
+	Since       time.Time
+	State       string
+}
+
+func (h LockHolder) String() string {
+	parts := []string{fmt.Sprintf("pid %d", h.PID)}
+	if h.Application != "" {
+		parts = append(parts, h.Application)
+	}
+	if h.ClientAddr != "" {
+		parts = append(parts, "cliente "+h.ClientAddr)
+	}
+	if !h.Since.IsZero() {
+		parts = append(parts, "conectado desde "+h.Since.Format(time.RFC3339))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// lockObjectIDs splits a bigint advisory lock key the way pg_locks shows it:
+// classid holds the high 32 bits and objid the low ones, both unsigned, so a
+// negative key (about half of the LockKey values) still maps to valid oids.
+func lockObjectIDs(key int64) (classid, objid uint32) {
+	return uint32(uint64(key) >> 32), uint32(key)
+}
+
+// Holder returns the session holding the lock, or nil when nobody does.
+func (l *AdvisoryLock) Holder(ctx context.Context) (*LockHolder, error) {
+	var h LockHolder
+	classid, objid := lockObjectIDs(l.key)
+	// uma chave bigint fica em classid (32 bits altos) e objid (baixos), com objsubid=1
+	err := l.conn.QueryRowContext(ctx, `
+SELECT a.pid, coalesce(a.application_name, ''), coalesce(host(a.client_addr), ''),
+       coalesce(a.backend_start, 'epoch'), coalesce(a.state, '')
+FROM pg_locks l
+JOIN pg_stat_activity a ON a.pid = l.pid
+WHERE l.locktype = 'advisory' AND l.granted
+  AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+  AND l.classid = $1::bigint::oid
+  AND l.objid = $2::bigint::oid
+  AND l.objsubid = 1
+LIMIT 1`, int64(classid), int64(objid)).Scan(&h.PID, &h.Application, &h.ClientAddr, &h.Since, &h.State)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if h.Since.Unix() == 0 {
+		h.Since = time.Time{}
+	}
+	return &h, nil
+}
+
+// Release unlocks and returns the connection. It is safe to call when the
+// lock was not taken; closing the session releases the lock anyway.
+func (l *AdvisoryLock) Release() error {
+	var err error
+	if l.held {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err = l.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, l.key)
+		l.held = false
+	}
+	if cerr := l.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// LockBusyError is returned when another session holds the lock.
+type LockBusyError struct {
+	Holder *LockHolder
+}
+
+func (e *LockBusyError) Error() string {
+	if e.Holder == nil {
+		return "outra execução do loader está em andamento"
+	}
+	return "outra execução do loader está em andamento (" + e.Holder.String() + ")"
+}
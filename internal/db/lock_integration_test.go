@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAdvisoryLock_RealIntegration(t *testing.T) {
+	if strings.TrimSpace(os.Getenv("RUN_INTEGRATION")) != "1" {
+		t.Skip("set RUN_INTEGRATION=1 to run integration tests")
+	}
+
+	loadDotEnvForDBTest()
+
+	ctx := context.Background()
+	conn, err := OpenSQL(ctx, Options{Host: os.Getenv("DB_HOST"), Port: os.Getenv("DB_PORT"), User: os.Getenv("DB_USER"), Password: os.Getenv("DB_PASSWORD"), Name: os.Getenv("DB_NAME")})
+	if err != nil {
+		t.Fatalf("OpenSQL: %v", err)
+	}
+	defer conn.Close()
+
+	// chaves próprias do teste, para não disputar com um loader de verdade;
+	// a negativa confere que o dono ainda é identificado
+	for _, key := range []int64{LoaderLockKey + 1, -(LoaderLockKey + 1)} {
+		testAdvisoryLock(t, ctx, conn, key)
+	}
+}
+
+func testAdvisoryLock(t *testing.T, ctx context.Context, conn *sql.DB, key int64) {
+	t.Helper()
+
+	first, err := NewAdvisoryLock(ctx, conn, key)
+	if err != nil {
+		t.Fatalf("NewAdvisoryLock: %v", err)
+	}
+	if ok, err := first.TryAcquire(ctx); err != nil || !ok {
+		t.Fatalf("first TryAcquire: ok=%v err=%v", ok, err)
+	}
+
+	second, err := NewAdvisoryLock(ctx, conn, key)
+	if err != nil {
+		t.Fatalf("NewAdvisoryLock: %v", err)
+	}
+	defer second.Release()
+	if ok, err := second.TryAcquire(ctx); err != nil || ok {
+		t.Fatalf("second TryAcquire must fail: ok=%v err=%v", ok, err)
+	}
+	holder, err := second.Holder(ctx)
+	if err != nil || holder == nil {
+		t.Fatalf("Holder: %v %v", holder, err)
+	}
+	if !strings.HasPrefix(holder.Application, "rfcnpj-loader@") {
+		t.Fatalf("unexpected holder %+v", holder)
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := second.Acquire(wctx); err == nil || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire with cancelled context: %v", err)
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	third, err := NewAdvisoryLock(ctx, conn, key)
+	if err != nil {
+		t.Fatalf("NewAdvisoryLock: %v", err)
+	}
+	defer third.Release()
+	if ok, err := third.TryAcquire(ctx); err != nil || !ok {
+		t.Fatalf("lock not released: ok=%v err=%v", ok, err)
+	}
+	if h, err := third.Holder(ctx); err != nil || h == nil {
+		t.Fatalf("holder after acquire: %v %v", h, err)
+	}
+}
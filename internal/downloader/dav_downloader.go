@@ -12,23 +12,15 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/abriciof/rfcnpj-loader/internal/dav"
 )
 
-type Wanted struct {
-	Empresas         bool
-	Estabelecimentos bool
-	Socios           bool
-	Simples          bool
-	Motivos          bool
-	Qualificacoes    bool
-	Cnaes            bool
-	Municipios       bool
-	Naturezas        bool
-	Paises           bool
-}
+// Wanted is the set of tables (loaders.TableSpec names) whose zips are
+// downloaded.
+type Wanted map[string]bool
 
 var (
 	reEmpresas         = regexp.MustCompile(`(?i)/Empresas\d+\.zip$`)
@@ -36,31 +28,41 @@ var (
 	reSocios           = regexp.MustCompile(`(?i)/Socios\d+\.zip$`)
 )
 
+// TableForZip maps a source zip (href or file name) to the table it loads.
+// These are the only rules used to tie a zip to a table: FilterWanted uses them
+// to pick downloads and the scan stage uses them to classify extracted files.
+func TableForZip(name string) (string, bool) {
+	h := "/" + path.Base(name)
+	lh := strings.ToLower(h)
+	switch {
+	case strings.HasSuffix(lh, "/simples.zip"):
+		return "simples", true
+	case strings.HasSuffix(lh, "/motivos.zip"):
+		return "moti", true
+	case strings.HasSuffix(lh, "/qualificacoes.zip"):
+		return "quals", true
+	case strings.HasSuffix(lh, "/cnaes.zip"):
+		return "cnae", true
+	case strings.HasSuffix(lh, "/municipios.zip"):
+		return "munic", true
+	case strings.HasSuffix(lh, "/naturezas.zip"):
+		return "natju", true
+	case strings.HasSuffix(lh, "/paises.zip"):
+		return "pais", true
+	case reEmpresas.MatchString(h):
+		return "empresa", true
+	case reEstabelecimentos.MatchString(h):
+		return "estabelecimento", true
+	case reSocios.MatchString(h):
+		return "socios", true
+	}
+	return "", false
+}
+
 func FilterWanted(items []dav.Item, want Wanted) []dav.Item {
 	out := make([]dav.Item, 0, len(items))
 	for _, it := range items {
-		h := it.Href
-		lh := strings.ToLower(h)
-		switch {
-		case want.Simples && strings.HasSuffix(lh, "/simples.zip"):
-			out = append(out, it)
-		case want.Motivos && strings.HasSuffix(lh, "/motivos.zip"):
-			out = append(out, it)
-		case want.Qualificacoes && strings.HasSuffix(lh, "/qualificacoes.zip"):
-			out = append(out, it)
-		case want.Cnaes && strings.HasSuffix(lh, "/cnaes.zip"):
-			out = append(out, it)
-		case want.Municipios && strings.HasSuffix(lh, "/municipios.zip"):
-			out = append(out, it)
-		case want.Naturezas && strings.HasSuffix(lh, "/naturezas.zip"):
-			out = append(out, it)
-		case want.Paises && strings.HasSuffix(lh, "/paises.zip"):
-			out = append(out, it)
-		case want.Empresas && reEmpresas.MatchString(h):
-			out = append(out, it)
-		case want.Estabelecimentos && reEstabelecimentos.MatchString(h):
-			out = append(out, it)
-		case want.Socios && reSocios.MatchString(h):
+		if table, ok := TableForZip(it.Href); ok && want[table] {
 			out = append(out, it)
 		}
 	}
@@ -73,8 +75,13 @@ type DAVDownloader struct {
 	Workers        int
 	EnableDownload bool // equivalente ao bloco comentado do Python
 	http           *http.Client
+	downloaded     atomic.Int64
 }
 
+// BytesDownloaded is how much was transferred so far; files skipped because
+// they were already on disk don't count.
+func (d *DAVDownloader) BytesDownloaded() int64 { return d.downloaded.Load() }
+
 func NewDAVDownloader(baseDomain, outputDir string, workers int, enable bool) *DAVDownloader {
 	if workers <= 0 {
 		workers = 4
@@ -137,19 +144,32 @@ func (d *DAVDownloader) DownloadAll(ctx context.Context, items []dav.Item) error
 	return nil
 }
 
+// Current reports whether the zip of it is already in OutputDir and
+// unchanged, so DownloadAll skips it: same size (check_diff do Python) and,
+// when the server tells, same modification time (a zip republished with the
+// same size).
+func (d *DAVDownloader) Current(it dav.Item) bool {
+	st, err := os.Stat(filepath.Join(d.OutputDir, path.Base(it.Href)))
+	if err != nil {
+		return false
+	}
+	remoteMod, hasRemoteMod := parseLastModified(it.LastModified)
+	sameMod := !hasRemoteMod || st.ModTime().Equal(remoteMod)
+	return it.ContentLength > 0 && st.Size() == it.ContentLength && sameMod
+}
+
 func (d *DAVDownloader) downloadOne(ctx context.Context, it dav.Item) error {
 	url := d.BaseDomain + it.Href
 	fileName := path.Base(it.Href)
 	dst := filepath.Join(d.OutputDir, fileName)
 
-	// check_diff por tamanho (equivalente ao Python)
-	if st, err := os.Stat(dst); err == nil {
-		if it.ContentLength > 0 && st.Size() == it.ContentLength {
-			slog.Info("download skipped (same size)", "file", fileName, "size", st.Size())
-			return nil // já baixado e igual
-		}
-		_ = os.Remove(dst)
+	remoteMod, hasRemoteMod := parseLastModified(it.LastModified)
+
+	if d.Current(it) {
+		slog.Info("download skipped (same size)", "file", fileName, "size", it.ContentLength)
+		return nil // já baixado e igual
 	}
+	_ = os.Remove(dst)
 	slog.Info("downloading file", "file", fileName, "url", url)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -176,11 +196,17 @@ func (d *DAVDownloader) downloadOne(ctx context.Context, it dav.Item) error {
 	defer f.Close()
 
 	start := time.Now()
-	if _, err := io.Copy(f, resp.Body); err != nil {
+	n, err := io.Copy(f, resp.Body)
+	d.downloaded.Add(n)
+	if err != nil {
 		return err
 	}
 	_ = f.Close()
 
+	if hasRemoteMod {
+		// guarda a data remota para detectar republicações na próxima execução
+		_ = os.Chtimes(tmp, remoteMod, remoteMod)
+	}
 	if err := os.Rename(tmp, dst); err != nil {
 		return err
 	}
@@ -189,3 +215,15 @@ func (d *DAVDownloader) downloadOne(ctx context.Context, it dav.Item) error {
 	_ = start // se quiser logar tempo por arquivo
 	return nil
 }
+
+func parseLastModified(v string) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/abriciof/rfcnpj-loader/internal/dav"
 )
@@ -25,17 +26,39 @@ func TestFilterWanted(t *testing.T) {
 	}
 
 	got := FilterWanted(items, Wanted{
-		Simples:          true,
-		Motivos:          true,
-		Empresas:         true,
-		Estabelecimentos: true,
-		Socios:           true,
+		"simples":         true,
+		"moti":            true,
+		"empresa":         true,
+		"estabelecimento": true,
+		"socios":          true,
 	})
 	if len(got) != 5 {
 		t.Fatalf("expected 5 matches, got %d", len(got))
 	}
 }
 
+func TestTableForZip(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"/x/Empresas0.zip":       "empresa",
+		"Estabelecimentos9.zip":  "estabelecimento",
+		"/x/Socios3.zip":         "socios",
+		"/x/Simples.zip":         "simples",
+		"/x/Qualificacoes.zip":   "quals",
+		"/x/Paises.zip":          "pais",
+		"/x/Empresas.zip":        "",
+		"/x/SimplesNacional.zip": "",
+		"/x/README.txt":          "",
+	}
+	for in, want := range cases {
+		got, ok := TableForZip(in)
+		if got != want || ok != (want != "") {
+			t.Fatalf("TableForZip(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+}
+
 func TestNewDAVDownloader_Defaults(t *testing.T) {
 	t.Parallel()
 
@@ -92,6 +115,9 @@ func TestDownloadOne_DownloadsFile(t *testing.T) {
 	if atomic.LoadInt32(&hits) != 1 {
 		t.Fatalf("expected 1 request, got %d", hits)
 	}
+	if got := d.BytesDownloaded(); got != int64(len("zip-content")) {
+		t.Fatalf("expected %d bytes counted, got %d", len("zip-content"), got)
+	}
 }
 
 func TestDownloadOne_SkipsWhenSameSize(t *testing.T) {
@@ -120,5 +146,50 @@ func TestDownloadOne_SkipsWhenSameSize(t *testing.T) {
 	if atomic.LoadInt32(&hits) != 0 {
 		t.Fatalf("expected no request when same size, got %d", hits)
 	}
+	if d.BytesDownloaded() != 0 {
+		t.Fatalf("skipped file must not count as downloaded")
+	}
 }
 
+func TestDownloadOne_RedownloadsWhenRepublished(t *testing.T) {
+	t.Parallel()
+
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		_, _ = w.Write([]byte("new-data"))
+	}))
+	defer srv.Close()
+
+	out := t.TempDir()
+	existingPath := filepath.Join(out, "file.zip")
+	if err := os.WriteFile(existingPath, []byte("old-data"), 0o644); err != nil {
+		t.Fatalf("write existing file: %v", err)
+	}
+	old := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(existingPath, old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	d := NewDAVDownloader(srv.URL, out, 1, true)
+	d.http = srv.Client()
+	item := dav.Item{
+		Href:          "/file.zip",
+		ContentLength: int64(len("new-data")),
+		LastModified:  "Thu, 15 Jan 2026 09:30:00 GMT",
+	}
+	if err := d.downloadOne(context.Background(), item); err != nil {
+		t.Fatalf("downloadOne returned error: %v", err)
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("expected republished file to be downloaded again, got %d requests", hits)
+	}
+
+	// same size and same Last-Modified now: skipped
+	if err := d.downloadOne(context.Background(), item); err != nil {
+		t.Fatalf("downloadOne returned error: %v", err)
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("expected unchanged file to be skipped, got %d requests", hits)
+	}
+}
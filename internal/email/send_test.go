@@ -0,0 +1,375 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// fakeServer is a minimal SMTP server that accepts one session and records
+// what the client sent. It supports implicit TLS, STARTTLS and AUTH PLAIN,
+// LOGIN and CRAM-MD5.
+type fakeServer struct {
+	ln       net.Listener
+	tls      *tls.Config
+	implicit bool
+	starttls bool
+	auth     string // mechanisms advertised, e.g. "LOGIN CRAM-MD5"
+	pass     string // expected password for CRAM-MD5
+
+	done chan error
+	got  session
+}
+
+type session struct {
+	TLS      bool
+	AuthMech string
+	User     string
+	Pass     string
+	From     string
+	Rcpt     []string
+	Data     string
+}
+
+// testTLS returns a server certificate for 127.0.0.1 and a client config
+// that trusts it.
+func testTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return &tls.Config{Certificates: srv.TLS.Certificates}, &tls.Config{RootCAs: pool}
+}
+
+func startFakeServer(t *testing.T, fs *fakeServer) SMTPConfig {
+	t.Helper()
+	var (
+		ln  net.Listener
+		err error
+	)
+	if fs.implicit {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", fs.tls)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	fs.ln = ln
+	fs.done = make(chan error, 1)
+	go func() { fs.done <- fs.serve() }()
+
+	host, port, err := splitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("splitHostPort failed: %v", err)
+	}
+	return SMTPConfig{Host: host, Port: port}
+}
+
+func (fs *fakeServer) wait(t *testing.T) session {
+	t.Helper()
+	if err := <-fs.done; err != nil {
+		t.Fatalf("fake smtp server failed: %v", err)
+	}
+	return fs.got
+}
+
+func (fs *fakeServer) serve() error {
+	conn, err := fs.ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	fs.got.TLS = fs.implicit
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	write := func(format string, args ...any) error {
+		fmt.Fprintf(w, format+"\r\n", args...)
+		return w.Flush()
+	}
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	if err := write("220 localhost ESMTP ready"); err != nil {
+		return err
+	}
+	for {
+		line, err := readLine()
+		if err != nil {
+			return err
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			ext := []string{"localhost"}
+			if fs.starttls && !fs.got.TLS {
+				ext = append(ext, "STARTTLS")
+			}
+			if fs.auth != "" {
+				ext = append(ext, "AUTH "+fs.auth)
+			}
+			for i, e := range ext {
+				sep := "-"
+				if i == len(ext)-1 {
+					sep = " "
+				}
+				if err := write("250%s%s", sep, e); err != nil {
+					return err
+				}
+			}
+		case cmd == "STARTTLS":
+			if err := write("220 go ahead"); err != nil {
+				return err
+			}
+			tc := tls.Server(conn, fs.tls)
+			if err := tc.Handshake(); err != nil {
+				return err
+			}
+			conn = tc
+			r, w = bufio.NewReader(conn), bufio.NewWriter(conn)
+			fs.got.TLS = true
+		case strings.HasPrefix(cmd, "AUTH PLAIN "):
+			b, err := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			if err != nil {
+				return err
+			}
+			parts := strings.Split(string(b), "\x00")
+			fs.got.AuthMech, fs.got.User, fs.got.Pass = "PLAIN", parts[1], parts[2]
+			if err := write("235 ok"); err != nil {
+				return err
+			}
+		case cmd == "AUTH LOGIN":
+			fs.got.AuthMech = "LOGIN"
+			for _, prompt := range []string{"Username:", "Password:"} {
+				if err := write("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt))); err != nil {
+					return err
+				}
+				resp, err := readLine()
+				if err != nil {
+					return err
+				}
+				b, err := base64.StdEncoding.DecodeString(resp)
+				if err != nil {
+					return err
+				}
+				if prompt == "Username:" {
+					fs.got.User = string(b)
+				} else {
+					fs.got.Pass = string(b)
+				}
+			}
+			if err := write("235 ok"); err != nil {
+				return err
+			}
+		case cmd == "AUTH CRAM-MD5":
+			fs.got.AuthMech = "CRAM-MD5"
+			challenge := "<1896.697170952@localhost>"
+			if err := write("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge))); err != nil {
+				return err
+			}
+			resp, err := readLine()
+			if err != nil {
+				return err
+			}
+			b, err := base64.StdEncoding.DecodeString(resp)
+			if err != nil {
+				return err
+			}
+			user, digest, _ := strings.Cut(string(b), " ")
+			mac := hmac.New(md5.New, []byte(fs.pass))
+			mac.Write([]byte(challenge))
+			if digest != hex.EncodeToString(mac.Sum(nil)) {
+				_ = write("535 bad digest")
+				return fmt.Errorf("bad CRAM-MD5 digest")
+			}
+			fs.got.User = user
+			if err := write("235 ok"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			fs.got.From = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			if err := write("250 ok"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			fs.got.Rcpt = append(fs.got.Rcpt, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			if err := write("250 ok"); err != nil {
+				return err
+			}
+		case cmd == "DATA":
+			if err := write("354 end with ."); err != nil {
+				return err
+			}
+			var data strings.Builder
+			for {
+				l, err := readLine()
+				if err != nil {
+					return err
+				}
+				if l == "." {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, ".") + "\r\n")
+			}
+			fs.got.Data = data.String()
+			if err := write("250 queued"); err != nil {
+				return err
+			}
+		case cmd == "QUIT":
+			return write("221 bye")
+		default:
+			if err := write("250 ok"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func TestSend_ImplicitTLSLoginAuthAndHeaders(t *testing.T) {
+	t.Parallel()
+
+	serverTLS, clientTLS := testTLS(t)
+	fs := &fakeServer{tls: serverTLS, implicit: true, auth: "LOGIN"}
+	cfg := startFakeServer(t, fs)
+	cfg.TLS = TLSImplicit
+	cfg.TLSConfig = clientTLS
+	cfg.User, cfg.Pass = "relay-user", "relay-pass"
+	cfg.From, cfg.FromName = "loader@example.test", "Carga CNPJ – Produção"
+	cfg.ReplyTo = "dados@example.test"
+	cfg.To = "a@example.test"
+	cfg.Cc = "b@example.test"
+	cfg.Bcc = "c@example.test"
+
+	if err := Send(cfg, Message{Subject: "Relatório do mês de Março", Text: "ok"}); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	got := fs.wait(t)
+
+	if !got.TLS || got.AuthMech != "LOGIN" || got.User != "relay-user" || got.Pass != "relay-pass" {
+		t.Fatalf("unexpected session: %+v", got)
+	}
+	if got.From != "loader@example.test" {
+		t.Fatalf("unexpected MAIL FROM %q", got.From)
+	}
+	if strings.Join(got.Rcpt, ",") != "a@example.test,b@example.test,c@example.test" {
+		t.Fatalf("unexpected RCPT TO %v", got.Rcpt)
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(got.Data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil || subject != "Relatório do mês de Março" {
+		t.Fatalf("unexpected subject %q (raw %q): %v", subject, m.Header.Get("Subject"), err)
+	}
+	if strings.Contains(m.Header.Get("Subject"), "ó") {
+		t.Fatalf("subject not RFC 2047 encoded: %q", m.Header.Get("Subject"))
+	}
+	from, err := m.Header.AddressList("From")
+	if err != nil || from[0].Name != "Carga CNPJ – Produção" || from[0].Address != "loader@example.test" {
+		t.Fatalf("unexpected From %q: %v", m.Header.Get("From"), err)
+	}
+	if m.Header.Get("Reply-To") != "dados@example.test" || m.Header.Get("Cc") != "b@example.test" {
+		t.Fatalf("unexpected Reply-To/Cc: %v", m.Header)
+	}
+	if m.Header.Get("Bcc") != "" {
+		t.Fatalf("Bcc must not be in the headers")
+	}
+	body, _ := io.ReadAll(m.Body)
+	if !bytes.Contains(body, []byte("ok")) {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestSend_StartTLSCRAMMD5(t *testing.T) {
+	t.Parallel()
+
+	serverTLS, clientTLS := testTLS(t)
+	fs := &fakeServer{tls: serverTLS, starttls: true, auth: "CRAM-MD5", pass: "segredo"}
+	cfg := startFakeServer(t, fs)
+	cfg.TLS = TLSStartTLS
+	cfg.TLSConfig = clientTLS
+	cfg.User, cfg.Pass, cfg.To = "u@example.test", "segredo", "a@example.test"
+
+	if err := Send(cfg, Message{Subject: "s", Text: "t"}); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	got := fs.wait(t)
+	if !got.TLS || got.AuthMech != "CRAM-MD5" || got.User != "u@example.test" {
+		t.Fatalf("unexpected session: %+v", got)
+	}
+	if got.From != "u@example.test" {
+		t.Fatalf("From must default to SMTP user, got %q", got.From)
+	}
+}
+
+func TestSend_StartTLSRequiredButNotOffered(t *testing.T) {
+	t.Parallel()
+
+	fs := &fakeServer{auth: "PLAIN"}
+	cfg := startFakeServer(t, fs)
+	cfg.TLS = TLSStartTLS
+	cfg.User, cfg.Pass, cfg.To = "u@example.test", "p", "a@example.test"
+
+	err := Send(cfg, Message{Subject: "s", Text: "t"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected STARTTLS error, got %v", err)
+	}
+}
+
+func TestSend_NoAuthPlainConnection(t *testing.T) {
+	t.Parallel()
+
+	fs := &fakeServer{auth: "PLAIN"}
+	cfg := startFakeServer(t, fs)
+	cfg.TLS = TLSNone
+	cfg.Auth = AuthNone
+	cfg.From, cfg.To = "loader@example.test", "a@example.test"
+
+	if !Enabled(cfg) {
+		t.Fatalf("expected Enabled=true with auth none and a From address")
+	}
+	if err := Send(cfg, Message{Subject: "s", Text: "t"}); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	got := fs.wait(t)
+	if got.TLS || got.AuthMech != "" || len(got.Rcpt) != 1 {
+		t.Fatalf("unexpected session: %+v", got)
+	}
+}
+
+func TestPickAuth(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"LOGIN PLAIN":    AuthPlain,
+		"CRAM-MD5 LOGIN": AuthLogin,
+		"cram-md5":       AuthCRAMMD5,
+		"XOAUTH2":        "",
+	}
+	for offered, want := range cases {
+		if got := pickAuth(offered); got != want {
+			t.Fatalf("pickAuth(%q) = %q, want %q", offered, got, want)
+		}
+	}
+}
@@ -1,55 +1,441 @@
 package email
 
 import (
+	"bytes"
 	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// TLS modes.
+const (
+	TLSAuto     = ""         // implicit on port 465, otherwise STARTTLS when offered
+	TLSNone     = "none"     // plain connection, never upgraded
+	TLSStartTLS = "starttls" // STARTTLS is required
+	TLSImplicit = "implicit" // TLS from the first byte (SMTPS, usually port 465)
+)
+
+// Auth mechanisms.
+const (
+	AuthAuto    = "" // best mechanism offered by the server, when credentials are set
+	AuthNone    = "none"
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+)
+
+const dialTimeout = 30 * time.Second
+
 type SMTPConfig struct {
 	Host string
 	Port int
 	User string
 	Pass string
 	To   string
+
+	TLS  string // see TLS modes
+	Auth string // see Auth mechanisms
+
+	// From defaults to User. FromName is the display name.
+	From     string
+	FromName string
+	ReplyTo  string
+	Cc       string
+	Bcc      string
+
+	// TLSConfig overrides the TLS client settings (e.g. a private CA);
+	// ServerName defaults to Host.
+	TLSConfig *tls.Config
 }
 
 func Enabled(cfg SMTPConfig) bool {
+	if strings.TrimSpace(cfg.To) == "" || sender(cfg) == "" {
+		return false
+	}
+	if strings.EqualFold(strings.TrimSpace(cfg.Auth), AuthNone) {
+		return true
+	}
 	return strings.TrimSpace(cfg.User) != "" &&
-		strings.TrimSpace(cfg.Pass) != "" &&
-		strings.TrimSpace(cfg.To) != ""
+		strings.TrimSpace(cfg.Pass) != ""
+}
+
+// Message is a notification e-mail. When HTML is set the message is sent as
+// multipart/alternative with Text as the plain-text fallback.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+	// Attachments turn the message into multipart/mixed.
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// envelope holds the addresses of one message.
+type envelope struct {
+	From    mail.Address
+	To      []string
+	Cc      []string
+	Bcc     []string
+	ReplyTo string
+}
+
+func (e envelope) recipients() []string {
+	out := make([]string, 0, len(e.To)+len(e.Cc)+len(e.Bcc))
+	out = append(out, e.To...)
+	out = append(out, e.Cc...)
+	return append(out, e.Bcc...)
 }
 
-func Send(cfg SMTPConfig, subject, body string) error {
-	recipients, err := parseRecipients(cfg.To)
+func sender(cfg SMTPConfig) string {
+	if from := strings.TrimSpace(cfg.From); from != "" {
+		return from
+	}
+	return strings.TrimSpace(cfg.User)
+}
+
+func newEnvelope(cfg SMTPConfig) (envelope, error) {
+	to, err := parseRecipients(cfg.To)
+	if err != nil {
+		return envelope{}, err
+	}
+	env := envelope{
+		To:      to,
+		Cc:      parseAddressList(cfg.Cc),
+		Bcc:     parseAddressList(cfg.Bcc),
+		ReplyTo: strings.TrimSpace(cfg.ReplyTo),
+	}
+	env.From = mail.Address{Name: strings.TrimSpace(cfg.FromName), Address: sender(cfg)}
+	if env.From.Address == "" {
+		return envelope{}, errors.New("smtp from address is required (MAIL_FROM or SMTP_USER)")
+	}
+	return env, nil
+}
+
+func Send(cfg SMTPConfig, msg Message) error {
+	env, err := newEnvelope(cfg)
 	if err != nil {
 		return err
 	}
+	raw, err := buildMessage(env, msg)
+	if err != nil {
+		return err
+	}
+
+	c, err := dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := authenticate(c, cfg, false); err != nil {
+		return err
+	}
+	if err := c.Mail(env.From.Address); err != nil {
+		return err
+	}
+	for _, rcpt := range env.recipients() {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("rcpt %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// dial connects according to cfg.TLS and, for STARTTLS, upgrades the
+// connection before anything else is sent.
+func dial(cfg SMTPConfig) (*smtp.Client, error) {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsCfg := &tls.Config{ServerName: cfg.Host}
+	if cfg.TLSConfig != nil {
+		tlsCfg = cfg.TLSConfig.Clone()
+		if tlsCfg.ServerName == "" {
+			tlsCfg.ServerName = cfg.Host
+		}
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(cfg.TLS))
+	if mode == TLSAuto && cfg.Port == 465 {
+		mode = TLSImplicit
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	switch mode {
+	case TLSImplicit:
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsCfg)
+	case TLSAuto, TLSNone, TLSStartTLS:
+		conn, err = dialer.Dial("tcp", addr)
+	default:
+		return nil, fmt.Errorf("SMTP_TLS inválido: %q (use none, starttls ou implicit)", cfg.TLS)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if mode == TLSAuto || mode == TLSStartTLS {
+		ok, _ := c.Extension("STARTTLS")
+		switch {
+		case ok:
+			if err := c.StartTLS(tlsCfg); err != nil {
+				c.Close()
+				return nil, err
+			}
+		case mode == TLSStartTLS:
+			c.Close()
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+	}
+	return c, nil
+}
+
+// authenticate logs in with the mechanism in cfg.Auth. In auto mode it picks
+// PLAIN, LOGIN or CRAM-MD5, in that order, among the ones the server offers,
+// and skips auth when there are no credentials.
+func authenticate(c *smtp.Client, cfg SMTPConfig, requireAuth bool) error {
+	mech := strings.ToLower(strings.TrimSpace(cfg.Auth))
+	if mech == AuthNone {
+		return nil
+	}
+	user := strings.TrimSpace(cfg.User)
+	pass := strings.TrimSpace(cfg.Pass)
+	if user == "" || pass == "" {
+		if requireAuth || mech != AuthAuto {
+			return errors.New("smtp user and password are required for auth")
+		}
+		return nil
+	}
 
-	from := strings.TrimSpace(cfg.User)
-	if from == "" {
-		return errors.New("smtp user (from) is required")
+	ok, offered := c.Extension("AUTH")
+	if !ok {
+		if requireAuth || mech != AuthAuto {
+			return errors.New("smtp server does not support AUTH")
+		}
+		return nil
+	}
+	if mech == AuthAuto {
+		mech = pickAuth(offered)
+		if mech == "" {
+			return fmt.Errorf("no supported smtp auth mechanism offered (%s)", offered)
+		}
 	}
 
-	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
 	var auth smtp.Auth
-	if strings.TrimSpace(cfg.User) != "" && strings.TrimSpace(cfg.Pass) != "" {
-		auth = smtp.PlainAuth("", cfg.User, cfg.Pass, cfg.Host)
+	switch mech {
+	case AuthPlain:
+		auth = smtp.PlainAuth("", user, pass, cfg.Host)
+	case AuthLogin:
+		auth = &loginAuth{user: user, pass: pass, host: cfg.Host}
+	case AuthCRAMMD5:
+		auth = smtp.CRAMMD5Auth(user, pass)
+	default:
+		return fmt.Errorf("SMTP_AUTH inválido: %q (use plain, login, cram-md5 ou none)", cfg.Auth)
+	}
+	return c.Auth(auth)
+}
+
+func pickAuth(offered string) string {
+	mechs := map[string]bool{}
+	for _, m := range strings.Fields(strings.ToUpper(offered)) {
+		mechs[m] = true
 	}
+	switch {
+	case mechs["PLAIN"]:
+		return AuthPlain
+	case mechs["LOGIN"]:
+		return AuthLogin
+	case mechs["CRAM-MD5"]:
+		return AuthCRAMMD5
+	}
+	return ""
+}
 
-	msg := strings.Builder{}
-	msg.WriteString("From: " + from + "\r\n")
-	msg.WriteString("To: " + strings.Join(recipients, ", ") + "\r\n")
-	msg.WriteString("Subject: " + subject + "\r\n")
-	msg.WriteString("MIME-Version: 1.0\r\n")
-	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-	msg.WriteString("\r\n")
-	msg.WriteString(body)
-	msg.WriteString("\r\n")
+// loginAuth implements the (non-standard but common) LOGIN mechanism. Like
+// smtp.PlainAuth it refuses to send the password over an unencrypted
+// connection, except to localhost.
+type loginAuth struct {
+	user, pass, host string
+}
 
-	return smtp.SendMail(addr, auth, from, recipients, []byte(msg.String()))
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:", "user name", "username":
+		return []byte(a.user), nil
+	case "password:", "password":
+		return []byte(a.pass), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+func buildMessage(env envelope, msg Message) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("From: " + env.From.String() + "\r\n")
+	b.WriteString("To: " + strings.Join(env.To, ", ") + "\r\n")
+	if len(env.Cc) > 0 {
+		b.WriteString("Cc: " + strings.Join(env.Cc, ", ") + "\r\n")
+	}
+	if env.ReplyTo != "" {
+		b.WriteString("Reply-To: " + env.ReplyTo + "\r\n")
+	}
+	// RFC 2047: os assuntos têm acento ("Relatório", "Mês")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	bodyHeader, body, err := bodyPart(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Attachments) == 0 {
+		for _, k := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if v := bodyHeader.Get(k); v != "" {
+				b.WriteString(k + ": " + v + "\r\n")
+			}
+		}
+		b.WriteString("\r\n")
+		b.Write(body)
+		return b.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&b)
+	b.WriteString("Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n")
+	b.WriteString("\r\n")
+	w, err := mw.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	for _, a := range msg.Attachments {
+		ct := a.ContentType
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(ct, map[string]string{"name": a.Name})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(w, a.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// bodyPart renders the text (and HTML alternative) of msg and returns the
+// headers that describe it.
+func bodyPart(msg Message) (textproto.MIMEHeader, []byte, error) {
+	var b bytes.Buffer
+	if msg.HTML == "" {
+		err := writeQuotedPrintable(&b, msg.Text)
+		return textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, b.Bytes(), err
+	}
+
+	mw := multipart.NewWriter(&b)
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+	return textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + mw.Boundary()},
+	}, b.Bytes(), nil
+}
+
+// writeBase64 writes data in base64 lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) error {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		if _, err := io.WriteString(w, enc[:76]+"\r\n"); err != nil {
+			return err
+		}
+		enc = enc[76:]
+	}
+	_, err := io.WriteString(w, enc+"\r\n")
+	return err
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
 }
 
 func CheckConnection(cfg SMTPConfig) error {
@@ -61,34 +447,15 @@ func CheckConnectionRequireAuth(cfg SMTPConfig) error {
 }
 
 func checkConnection(cfg SMTPConfig, requireAuth bool) error {
-	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-	client, err := smtp.Dial(addr)
+	client, err := dial(cfg)
 	if err != nil {
 		return err
 	}
 	defer client.Close()
 
-	user := strings.TrimSpace(cfg.User)
-	pass := strings.TrimSpace(cfg.Pass)
-	hasCreds := user != "" && pass != ""
-
-	if hasCreds || requireAuth {
-		if ok, _ := client.Extension("STARTTLS"); ok {
-			if err := client.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
-				return err
-			}
-		}
-
-		if ok, _ := client.Extension("AUTH"); ok {
-			auth := smtp.PlainAuth("", user, pass, cfg.Host)
-			if err := client.Auth(auth); err != nil {
-				return err
-			}
-		} else if requireAuth {
-			return errors.New("smtp server does not support AUTH")
-		}
+	if err := authenticate(client, cfg, requireAuth); err != nil {
+		return err
 	}
-
 	if err := client.Noop(); err != nil {
 		return err
 	}
@@ -113,3 +480,12 @@ func parseRecipients(to string) ([]string, error) {
 	}
 	return recipients, nil
 }
+
+// parseAddressList splits an optional list separated by "," or ";".
+func parseAddressList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	out, _ := parseRecipients(s)
+	return out
+}
@@ -2,8 +2,14 @@ package email
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net"
+	"net/mail"
 	"reflect"
 	"strings"
 	"testing"
@@ -68,6 +74,118 @@ func TestParseRecipients(t *testing.T) {
 	}
 }
 
+func TestBuildMessage_MultipartAlternative(t *testing.T) {
+	t.Parallel()
+
+	raw, err := buildMessage(envelope{From: mail.Address{Address: "from@x.com"}, To: []string{"to@y.com"}}, Message{
+		Subject: "Relatório",
+		Text:    "Mês: Março\nlinha 2",
+		HTML:    "<p>Mês: <b>Março</b></p>",
+	})
+	if err != nil {
+		t.Fatalf("buildMessage returned error: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type %q: %v", m.Header.Get("Content-Type"), err)
+	}
+
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("next part: %v", err)
+		}
+		b, err := io.ReadAll(p) // multipart.Reader decodes quoted-printable
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		parts = append(parts, p.Header.Get("Content-Type")+"|"+string(b))
+	}
+
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+	if parts[0] != "text/plain; charset=UTF-8|Mês: Março\r\nlinha 2" {
+		t.Fatalf("unexpected text part: %q", parts[0])
+	}
+	if parts[1] != "text/html; charset=UTF-8|<p>Mês: <b>Março</b></p>" {
+		t.Fatalf("unexpected html part: %q", parts[1])
+	}
+}
+
+func TestBuildMessage_PlainTextOnly(t *testing.T) {
+	t.Parallel()
+
+	raw, err := buildMessage(envelope{From: mail.Address{Address: "from@x.com"}, To: []string{"to@y.com"}}, Message{Subject: "s", Text: "só texto"})
+	if err != nil {
+		t.Fatalf("buildMessage returned error: %v", err)
+	}
+	if !strings.Contains(string(raw), "Content-Type: text/plain; charset=UTF-8") {
+		t.Fatalf("expected a plain-text message:\n%s", raw)
+	}
+}
+
+func TestBuildMessage_Attachment(t *testing.T) {
+	t.Parallel()
+
+	raw, err := buildMessage(envelope{From: mail.Address{Address: "from@x.com"}, To: []string{"to@y.com"}}, Message{
+		Subject: "s",
+		Text:    "texto",
+		HTML:    "<p>html</p>",
+		Attachments: []Attachment{{
+			Name:        "relatório.json",
+			ContentType: "application/json",
+			Data:        []byte(`{"schema_version":1}`),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("buildMessage returned error: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("unexpected content type %q: %v", m.Header.Get("Content-Type"), err)
+	}
+
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	body, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("body part: %v", err)
+	}
+	if ct, _, _ := mime.ParseMediaType(body.Header.Get("Content-Type")); ct != "multipart/alternative" {
+		t.Fatalf("first part must be the body, got %q", body.Header.Get("Content-Type"))
+	}
+
+	att, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("attachment part: %v", err)
+	}
+	if att.FileName() != "relatório.json" {
+		t.Fatalf("unexpected filename %q", att.FileName())
+	}
+	data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, att))
+	if err != nil || string(data) != `{"schema_version":1}` {
+		t.Fatalf("unexpected attachment %q: %v", data, err)
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Fatalf("expected 2 parts, got more (%v)", err)
+	}
+}
+
 func runFakeSMTPServer(ln net.Listener, errCh chan<- error) {
 	conn, err := ln.Accept()
 	if err != nil {
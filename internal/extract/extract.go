@@ -3,6 +3,7 @@ package extract
 import (
 	"archive/zip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -12,15 +13,16 @@ import (
 )
 
 type Extractor struct {
-	Workers      int
+	Workers       int
 	EnableExtract bool // equivalente ao bloco comentado do Python
+	Limits        Limits
 }
 
 func NewExtractor(workers int, enable bool) *Extractor {
 	if workers <= 0 {
 		workers = 2
 	}
-	return &Extractor{Workers: workers, EnableExtract: enable}
+	return &Extractor{Workers: workers, EnableExtract: enable, Limits: DefaultLimits()}
 }
 
 func (e *Extractor) ExtractAll(ctx context.Context, zipFiles []string, destDir string) error {
@@ -34,6 +36,10 @@ func (e *Extractor) ExtractAll(ctx context.Context, zipFiles []string, destDir s
 		return err
 	}
 
+	// o primeiro erro cancela os demais workers
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	jobs := make(chan string)
 	errs := make(chan error, e.Workers)
 	var wg sync.WaitGroup
@@ -43,8 +49,9 @@ func (e *Extractor) ExtractAll(ctx context.Context, zipFiles []string, destDir s
 		go func() {
 			defer wg.Done()
 			for zf := range jobs {
-				if err := extractOne(zf, destDir); err != nil {
+				if err := extractOne(ctx, zf, destDir, e.Limits); err != nil {
 					errs <- err
+					cancel()
 					return
 				}
 			}
@@ -66,48 +73,172 @@ func (e *Extractor) ExtractAll(ctx context.Context, zipFiles []string, destDir s
 	wg.Wait()
 	close(errs)
 	for err := range errs {
-		if err != nil {
+		if err != nil && !errors.Is(err, context.Canceled) {
 			return err
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	slog.Info("extract stage completed", "files", len(zipFiles))
 	return nil
 }
 
-func extractOne(zipPath string, destDir string) error {
+func extractOne(ctx context.Context, zipPath string, destDir string, limits Limits) error {
+	st, err := os.Stat(zipPath)
+	if err != nil {
+		return err
+	}
+	prev, hasPrev, err := ReadManifest(destDir, zipPath)
+	if err != nil {
+		slog.Warn("ignoring unreadable extraction manifest", "zip", filepath.Base(zipPath), "error", err)
+		hasPrev = false
+	}
+	// zips têm GB: só calcula o hash quando tamanho ou data mudaram
+	sum := prev.ZipSHA256
+	if !hasPrev || !prev.sameZip(st) {
+		if sum, err = fileSHA256(ctx, zipPath); err != nil {
+			return err
+		}
+	}
+	if hasPrev && prev.ZipSHA256 == sum && prev.intact(destDir) {
+		slog.Info("extract skipped (output matches zip)", "zip", filepath.Base(zipPath), "entries", len(prev.Entries))
+		if prev.sameZip(st) && prev.hasModTimes() {
+			return nil
+		}
+		// mesmo conteúdo com outra data, ou manifesto sem as datas da saída:
+		// grava as atuais para não calcular de novo
+		prev.ZipSize, prev.ZipModTime = st.Size(), st.ModTime()
+		prev.recordModTimes(destDir)
+		return writeManifest(destDir, prev)
+	}
+
 	r, err := zip.OpenReader(zipPath)
 	if err != nil {
 		return err
 	}
 	defer r.Close()
 
+	if err := checkArchive(zipPath, destDir, r.File, limits); err != nil {
+		return err
+	}
+
+	var written int64
 	for _, f := range r.File {
-		fp := filepath.Join(destDir, f.Name)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fp, err := entryPath(destDir, f.Name)
+		if err != nil {
+			return err
+		}
 		if f.FileInfo().IsDir() {
 			if err := os.MkdirAll(fp, 0o755); err != nil {
 				return err
 			}
 			continue
 		}
-		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
-			return err
+
+		// mesma entrada (CRC e tamanho) já extraída por inteiro: não refaz
+		if hasPrev {
+			if pe, ok := prev.entry(f.Name); ok && pe.CRC32 == f.CRC32 && pe.Size == f.UncompressedSize64 && outputIntact(destDir, pe) {
+				slog.Debug("entry unchanged; skipping", "zip", filepath.Base(zipPath), "entry", f.Name)
+				written += int64(f.UncompressedSize64)
+				continue
+			}
 		}
-		rc, err := f.Open()
+
+		n, err := extractEntry(ctx, f, fp, entryLimit(f, limits, written))
+		written += n
 		if err != nil {
-			return err
+			if errors.Is(err, errLimitExceeded) {
+				return &UnsafeArchiveError{Zip: zipPath, Entries: []RejectedEntry{{Name: f.Name, Reason: err.Error()}}}
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return fmt.Errorf("extract %s: %w", f.Name, err)
 		}
-		out, err := os.Create(fp)
+	}
+	if hasPrev {
+		removeStale(zipPath, destDir, prev.stale(r.File))
+	}
+	return writeManifest(destDir, newManifest(zipPath, destDir, st, sum, r.File))
+}
+
+// removeStale deletes the output of entries a previous version of the zip had
+// and the current one doesn't, so they aren't loaded with the new files.
+func removeStale(zipPath, destDir string, stale []ManifestEntry) {
+	for _, e := range stale {
+		fp, err := entryPath(destDir, e.Name)
 		if err != nil {
-			rc.Close()
-			return err
+			continue
 		}
-		if _, err := io.Copy(out, rc); err != nil {
+		if err := os.Remove(fp); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("failed to remove stale extracted file", "zip", filepath.Base(zipPath), "entry", e.Name, "error", err)
+			continue
+		}
+		slog.Info("removed stale extracted file", "zip", filepath.Base(zipPath), "entry", e.Name)
+	}
+}
+
+// extractEntry writes one entry to a hidden temp file next to fp and renames it
+// over fp only after the copy and fsync succeed, so an interrupted extraction
+// never leaves a truncated file under the final name.
+func extractEntry(ctx context.Context, f *zip.File, fp string, limit int64) (n int64, err error) {
+	if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+		return 0, err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	tmp := partPath(fp)
+	out, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
 			out.Close()
-			rc.Close()
-			return fmt.Errorf("extract %s: %w", f.Name, err)
+			_ = os.Remove(tmp)
 		}
-		out.Close()
-		rc.Close()
+	}()
+
+	n, err = limitedCopy(out, ctxReader{ctx: ctx, r: rc}, limit)
+	if err != nil {
+		return n, err
 	}
-	return nil
+	if err = out.Sync(); err != nil {
+		return n, err
+	}
+	if err = out.Close(); err != nil {
+		return n, err
+	}
+	if err = os.Rename(tmp, fp); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// partPath is the temp name used while an entry is being written. It is a
+// dot-file so the scan stage never picks it up.
+func partPath(fp string) string {
+	return filepath.Join(filepath.Dir(fp), "."+filepath.Base(fp)+".part")
+}
+
+// ctxReader stops a long copy as soon as ctx is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
 }
@@ -3,6 +3,7 @@ package extract
 import (
 	"archive/zip"
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -50,6 +51,65 @@ func TestExtractAll_ExtractsFiles(t *testing.T) {
 	assertFileContent(t, filepath.Join(dest, "nested", "b.txt"), "beta")
 }
 
+func TestExtractAll_CancelledLeavesNoPartialFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "sample.zip")
+	createTestZip(t, zipPath, map[string]string{"a.txt": "alpha"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dest := filepath.Join(dir, "out")
+	err := NewExtractor(1, true).ExtractAll(ctx, []string{zipPath}, dest)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	assertEmptyDir(t, dest)
+}
+
+func TestExtractEntry_RemovesPartialOnFailure(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "sample.zip")
+	createTestZip(t, zipPath, map[string]string{"a.txt": "0123456789"})
+
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	defer r.Close()
+
+	dest := filepath.Join(dir, "out")
+	fp := filepath.Join(dest, "a.txt")
+	if _, err := extractEntry(context.Background(), r.File[0], fp, 4); !errors.Is(err, errLimitExceeded) {
+		t.Fatalf("expected errLimitExceeded, got %v", err)
+	}
+	assertEmptyDir(t, dest)
+
+	if _, err := extractEntry(context.Background(), r.File[0], fp, -1); err != nil {
+		t.Fatalf("extractEntry returned error: %v", err)
+	}
+	assertFileContent(t, fp, "0123456789")
+	if _, err := os.Stat(partPath(fp)); err == nil {
+		t.Fatal("temp file should be renamed away on success")
+	}
+}
+
+func assertEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("read dir %s: %v", dir, err)
+	}
+	for _, e := range entries {
+		t.Fatalf("expected no files in %s, found %s", dir, e.Name())
+	}
+}
+
 func createTestZip(t *testing.T, zipPath string, files map[string]string) {
 	t.Helper()
 
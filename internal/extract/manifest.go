@@ -0,0 +1,211 @@
+package extract
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestDir holds one extraction manifest per zip, inside the extraction
+// directory. It is hidden so the scan stage skips it.
+const ManifestDir = ".rfcnpj-extract"
+
+// Manifest records what was extracted from one zip, so a later run can tell
+// whether the output on disk still matches the archive. ZipSize and
+// ZipModTime let it trust ZipSHA256 without hashing the zip again.
+type Manifest struct {
+	Zip        string          `json:"zip"`
+	ZipSize    int64           `json:"zip_size"`
+	ZipModTime time.Time       `json:"zip_mtime"`
+	ZipSHA256  string          `json:"zip_sha256"`
+	Entries    []ManifestEntry `json:"entries"`
+}
+
+// ManifestEntry is one extracted entry. ModTime is the modification time of
+// the output file when the manifest was written; it is zero in manifests of
+// older versions.
+type ManifestEntry struct {
+	Name    string    `json:"name"`
+	Size    uint64    `json:"size"`
+	CRC32   uint32    `json:"crc32"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// ReadManifest returns the manifest of zipName in destDir, if any.
+func ReadManifest(destDir, zipName string) (Manifest, bool, error) {
+	b, err := os.ReadFile(manifestPath(destDir, zipName))
+	if errors.Is(err, os.ErrNotExist) {
+		return Manifest{}, false, nil
+	}
+	if err != nil {
+		return Manifest{}, false, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return Manifest{}, false, err
+	}
+	return m, true, nil
+}
+
+// ReadManifests returns every manifest found in destDir, sorted by zip name.
+// Unreadable manifests are logged and ignored.
+func ReadManifests(destDir string) ([]Manifest, error) {
+	entries, err := os.ReadDir(filepath.Join(destDir, ManifestDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Manifest
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		m, ok, err := ReadManifest(destDir, strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			slog.Warn("ignoring unreadable extraction manifest", "file", e.Name(), "error", err)
+			continue
+		}
+		if ok {
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Zip < out[j].Zip })
+	return out, nil
+}
+
+func writeManifest(destDir string, m Manifest) error {
+	p := manifestPath(destDir, m.Zip)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p + ".part"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func manifestPath(destDir, zipName string) string {
+	return filepath.Join(destDir, ManifestDir, filepath.Base(zipName)+".json")
+}
+
+func newManifest(zipPath, destDir string, st os.FileInfo, sum string, files []*zip.File) Manifest {
+	m := Manifest{Zip: filepath.Base(zipPath), ZipSize: st.Size(), ZipModTime: st.ModTime(), ZipSHA256: sum}
+	for _, f := range files {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		m.Entries = append(m.Entries, ManifestEntry{Name: f.Name, Size: f.UncompressedSize64, CRC32: f.CRC32})
+	}
+	m.recordModTimes(destDir)
+	return m
+}
+
+// recordModTimes sets the ModTime of every entry from its output file.
+func (m Manifest) recordModTimes(destDir string) {
+	for i, e := range m.Entries {
+		fp, err := entryPath(destDir, e.Name)
+		if err != nil {
+			continue
+		}
+		if st, err := os.Stat(fp); err == nil {
+			m.Entries[i].ModTime = st.ModTime()
+		}
+	}
+}
+
+// hasModTimes reports whether every entry has its output ModTime recorded.
+func (m Manifest) hasModTimes() bool {
+	for _, e := range m.Entries {
+		if e.ModTime.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// entry returns the manifest entry with the given name.
+func (m Manifest) entry(name string) (ManifestEntry, bool) {
+	for _, e := range m.Entries {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// sameZip reports whether st is the zip m was written for, judged by size and
+// modification time only.
+func (m Manifest) sameZip(st os.FileInfo) bool {
+	return m.ZipSHA256 != "" && m.ZipSize == st.Size() && m.ZipModTime.Equal(st.ModTime())
+}
+
+// stale returns the entries of m that files no longer has.
+func (m Manifest) stale(files []*zip.File) []ManifestEntry {
+	names := make(map[string]bool, len(files))
+	for _, f := range files {
+		names[f.Name] = true
+	}
+	var out []ManifestEntry
+	for _, e := range m.Entries {
+		if !names[e.Name] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// intact reports whether every entry of m is on disk with the recorded size
+// and modification time. The content isn't read (the outputs have GB): an
+// edit that keeps both, or an entry without ModTime, goes unnoticed.
+func (m Manifest) intact(destDir string) bool {
+	for _, e := range m.Entries {
+		if !outputIntact(destDir, e) {
+			return false
+		}
+	}
+	return true
+}
+
+func outputIntact(destDir string, e ManifestEntry) bool {
+	fp, err := entryPath(destDir, e.Name)
+	if err != nil {
+		return false
+	}
+	st, err := os.Stat(fp)
+	if err != nil || !st.Mode().IsRegular() || uint64(st.Size()) != e.Size {
+		return false
+	}
+	return e.ModTime.IsZero() || st.ModTime().Equal(e.ModTime)
+}
+
+func fileSHA256(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxReader{ctx: ctx, r: f}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
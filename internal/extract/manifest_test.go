@@ -0,0 +1,177 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractAll_SkipsUnchangedAndRedoesMissing(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "sample.zip")
+	createTestZip(t, zipPath, map[string]string{
+		"a.txt": "alpha",
+		"b.txt": "beta",
+	})
+	dest := filepath.Join(dir, "out")
+	e := NewExtractor(1, true)
+
+	if err := e.ExtractAll(context.Background(), []string{zipPath}, dest); err != nil {
+		t.Fatalf("first ExtractAll returned error: %v", err)
+	}
+	m, ok, err := ReadManifest(dest, "sample.zip")
+	if err != nil || !ok {
+		t.Fatalf("expected manifest after extraction, ok=%v err=%v", ok, err)
+	}
+	if len(m.Entries) != 2 || m.ZipSHA256 == "" {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+
+	// same size and time, different content: proves the second run did not
+	// rewrite it
+	writeFile(t, filepath.Join(dest, "a.txt"), "ALPHA")
+	ea, _ := m.entry("a.txt")
+	if err := os.Chtimes(filepath.Join(dest, "a.txt"), ea.ModTime, ea.ModTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if err := e.ExtractAll(context.Background(), []string{zipPath}, dest); err != nil {
+		t.Fatalf("second ExtractAll returned error: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dest, "a.txt"), "ALPHA")
+
+	// same size, edited later: extracted again
+	writeFile(t, filepath.Join(dest, "b.txt"), "BETA")
+	eb, _ := m.entry("b.txt")
+	edited := eb.ModTime.Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dest, "b.txt"), edited, edited); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if err := e.ExtractAll(context.Background(), []string{zipPath}, dest); err != nil {
+		t.Fatalf("ExtractAll after edit returned error: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dest, "b.txt"), "beta")
+
+	// missing output: only that entry is extracted again
+	if err := os.Remove(filepath.Join(dest, "b.txt")); err != nil {
+		t.Fatalf("remove output: %v", err)
+	}
+	if err := e.ExtractAll(context.Background(), []string{zipPath}, dest); err != nil {
+		t.Fatalf("third ExtractAll returned error: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dest, "a.txt"), "ALPHA")
+	assertFileContent(t, filepath.Join(dest, "b.txt"), "beta")
+
+	// changed zip: changed entries are extracted again
+	createTestZip(t, zipPath, map[string]string{
+		"a.txt": "alpha2",
+		"b.txt": "beta",
+	})
+	if err := e.ExtractAll(context.Background(), []string{zipPath}, dest); err != nil {
+		t.Fatalf("fourth ExtractAll returned error: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dest, "a.txt"), "alpha2")
+}
+
+func TestExtractAll_TrustsManifestWhenZipSizeAndTimeMatch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "sample.zip")
+	createTestZip(t, zipPath, map[string]string{"a.txt": "alpha"})
+	mod := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(zipPath, mod, mod); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	dest := filepath.Join(dir, "out")
+	e := NewExtractor(1, true)
+	if err := e.ExtractAll(context.Background(), []string{zipPath}, dest); err != nil {
+		t.Fatalf("first ExtractAll returned error: %v", err)
+	}
+
+	// same size and time, garbage content: a run that hashed or opened the zip
+	// would fail
+	st, err := os.Stat(zipPath)
+	if err != nil {
+		t.Fatalf("stat zip: %v", err)
+	}
+	writeFile(t, zipPath, strings.Repeat("x", int(st.Size())))
+	if err := os.Chtimes(zipPath, mod, mod); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if err := e.ExtractAll(context.Background(), []string{zipPath}, dest); err != nil {
+		t.Fatalf("second ExtractAll should trust the manifest, got %v", err)
+	}
+}
+
+func TestExtractAll_RemovesEntriesGoneFromZip(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "sample.zip")
+	createTestZip(t, zipPath, map[string]string{"a.txt": "alpha", "b.txt": "beta"})
+	dest := filepath.Join(dir, "out")
+	e := NewExtractor(1, true)
+	if err := e.ExtractAll(context.Background(), []string{zipPath}, dest); err != nil {
+		t.Fatalf("first ExtractAll returned error: %v", err)
+	}
+
+	createTestZip(t, zipPath, map[string]string{"a.txt": "alpha2"})
+	if err := e.ExtractAll(context.Background(), []string{zipPath}, dest); err != nil {
+		t.Fatalf("second ExtractAll returned error: %v", err)
+	}
+	assertFileContent(t, filepath.Join(dest, "a.txt"), "alpha2")
+	if _, err := os.Stat(filepath.Join(dest, "b.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("b.txt is no longer in the zip and should be removed, stat err=%v", err)
+	}
+	m, _, err := ReadManifest(dest, "sample.zip")
+	if err != nil || len(m.Entries) != 1 {
+		t.Fatalf("unexpected manifest: %+v (err=%v)", m, err)
+	}
+}
+
+func TestFileSHA256_HonoursContext(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "a.zip")
+	writeFile(t, p, "data")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fileSHA256(ctx, p); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestReadManifests(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"b.zip", "a.zip"} {
+		zipPath := filepath.Join(dir, name)
+		createTestZip(t, zipPath, map[string]string{name + ".csv": "x"})
+		if err := NewExtractor(1, true).ExtractAll(context.Background(), []string{zipPath}, filepath.Join(dir, "out")); err != nil {
+			t.Fatalf("ExtractAll returned error: %v", err)
+		}
+	}
+
+	got, err := ReadManifests(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatalf("ReadManifests returned error: %v", err)
+	}
+	if len(got) != 2 || got[0].Zip != "a.zip" || got[1].Zip != "b.zip" {
+		t.Fatalf("unexpected manifests: %+v", got)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
@@ -0,0 +1,159 @@
+package extract
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Limits protects the extraction against zip bombs. A zero field disables the
+// corresponding check.
+type Limits struct {
+	// MaxEntryBytes is the maximum uncompressed size of a single entry.
+	MaxEntryBytes int64
+	// MaxTotalBytes is the maximum uncompressed size of all entries of one zip.
+	MaxTotalBytes int64
+	// MaxRatio is the maximum uncompressed/compressed ratio of a single entry.
+	// Entries smaller than minRatioCheckBytes are not checked.
+	MaxRatio float64
+}
+
+const minRatioCheckBytes = 1 << 20
+
+// DefaultLimits are generous for the Receita files (the largest CSVs are a few
+// GB and compress around 5-10x) and still stop a bomb before it fills the disk.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxEntryBytes: 20 << 30,
+		MaxTotalBytes: 50 << 30,
+		MaxRatio:      200,
+	}
+}
+
+// UnsafeArchiveError lists every rejected entry of a zip.
+type UnsafeArchiveError struct {
+	Zip     string
+	Entries []RejectedEntry
+}
+
+type RejectedEntry struct {
+	Name   string
+	Reason string
+}
+
+func (e *UnsafeArchiveError) Error() string {
+	parts := make([]string, 0, len(e.Entries))
+	for _, r := range e.Entries {
+		parts = append(parts, fmt.Sprintf("%q (%s)", r.Name, r.Reason))
+	}
+	return fmt.Sprintf("zip inseguro %s: %d entrada(s) rejeitada(s): %s",
+		filepath.Base(e.Zip), len(e.Entries), strings.Join(parts, "; "))
+}
+
+var errLimitExceeded = errors.New("limite de tamanho descompactado excedido")
+
+// entryPath returns where an entry is written inside destDir, rejecting names
+// that would escape it (zip slip).
+func entryPath(destDir, name string) (string, error) {
+	local := filepath.FromSlash(name)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("caminho fora do diretório de destino")
+	}
+	fp := filepath.Join(destDir, local)
+	rel, err := filepath.Rel(destDir, fp)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("caminho fora do diretório de destino")
+	}
+	return fp, nil
+}
+
+// checkArchive validates every entry before anything is written, using the
+// sizes declared in the central directory. Since headers can lie, the copy
+// loop enforces the same limits again on the bytes actually produced (see
+// entryLimit).
+func checkArchive(zipPath, destDir string, files []*zip.File, limits Limits) error {
+	var (
+		rejected []RejectedEntry
+		total    uint64
+	)
+	for _, f := range files {
+		if _, err := entryPath(destDir, f.Name); err != nil {
+			rejected = append(rejected, RejectedEntry{Name: f.Name, Reason: err.Error()})
+			continue
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		size := f.UncompressedSize64
+		total += size
+		if limits.MaxEntryBytes > 0 && size > uint64(limits.MaxEntryBytes) {
+			rejected = append(rejected, RejectedEntry{
+				Name:   f.Name,
+				Reason: fmt.Sprintf("tamanho %d excede o limite por entrada de %d bytes", size, limits.MaxEntryBytes),
+			})
+			continue
+		}
+		if limits.MaxRatio > 0 && size >= minRatioCheckBytes {
+			ratio := float64(size) / float64(max(f.CompressedSize64, 1))
+			if ratio > limits.MaxRatio {
+				rejected = append(rejected, RejectedEntry{
+					Name:   f.Name,
+					Reason: fmt.Sprintf("taxa de compressão %.0f:1 excede o limite de %.0f:1", ratio, limits.MaxRatio),
+				})
+			}
+		}
+	}
+	if limits.MaxTotalBytes > 0 && total > uint64(limits.MaxTotalBytes) {
+		rejected = append(rejected, RejectedEntry{
+			Name:   "*",
+			Reason: fmt.Sprintf("tamanho total %d excede o limite de %d bytes", total, limits.MaxTotalBytes),
+		})
+	}
+
+	if len(rejected) > 0 {
+		return &UnsafeArchiveError{Zip: zipPath, Entries: rejected}
+	}
+	return nil
+}
+
+// entryLimit is the most bytes f may produce once written bytes of the zip
+// were already extracted, or -1 when nothing limits it. The ratio is checked
+// against CompressedSize64, which is exactly how much compressed data the
+// zip reader hands to the decompressor; the declared uncompressed size only
+// matters below minRatioCheckBytes, as in checkArchive.
+func entryLimit(f *zip.File, limits Limits, written int64) int64 {
+	limit := int64(-1)
+	if limits.MaxEntryBytes > 0 {
+		limit = limits.MaxEntryBytes
+	}
+	if limits.MaxTotalBytes > 0 && (limit < 0 || limits.MaxTotalBytes-written < limit) {
+		limit = limits.MaxTotalBytes - written
+	}
+	if limits.MaxRatio > 0 {
+		byRatio := max(int64(float64(f.CompressedSize64)*limits.MaxRatio), minRatioCheckBytes)
+		if limit < 0 || byRatio < limit {
+			limit = byRatio
+		}
+	}
+	return limit
+}
+
+// limitedCopy copies at most limit bytes (a negative limit means unlimited)
+// and fails with errLimitExceeded if src has more.
+func limitedCopy(dst io.Writer, src io.Reader, limit int64) (int64, error) {
+	if limit < 0 {
+		return io.Copy(dst, src)
+	}
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err != nil {
+		return n, err
+	}
+	if n > limit {
+		return n, errLimitExceeded
+	}
+	return n, nil
+}
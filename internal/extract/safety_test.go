@@ -0,0 +1,130 @@
+package extract
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractAll_RejectsZipSlip(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "evil.zip")
+	createTestZip(t, zipPath, map[string]string{
+		"ok.txt":           "fine",
+		"../escape.txt":    "boom",
+		"/abs/escape2.txt": "boom",
+	})
+
+	dest := filepath.Join(dir, "out")
+	err := NewExtractor(1, true).ExtractAll(context.Background(), []string{zipPath}, dest)
+
+	var unsafe *UnsafeArchiveError
+	if !errors.As(err, &unsafe) {
+		t.Fatalf("expected UnsafeArchiveError, got %v", err)
+	}
+	if len(unsafe.Entries) != 2 {
+		t.Fatalf("expected 2 rejected entries, got %+v", unsafe.Entries)
+	}
+	if !strings.Contains(err.Error(), "../escape.txt") {
+		t.Fatalf("error should name the offending entry: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); err == nil {
+		t.Fatal("entry escaped the destination directory")
+	}
+	if _, err := os.Stat(filepath.Join(dest, "ok.txt")); err == nil {
+		t.Fatal("nothing should be extracted from a rejected archive")
+	}
+}
+
+func TestExtractAll_EnforcesSizeLimits(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "big.zip")
+	createTestZip(t, zipPath, map[string]string{
+		"a.txt": "0123456789",
+		"b.txt": "01234",
+	})
+
+	cases := []struct {
+		name   string
+		limits Limits
+		want   string
+	}{
+		{"entry", Limits{MaxEntryBytes: 8}, "a.txt"},
+		{"total", Limits{MaxTotalBytes: 12}, "tamanho total"},
+	}
+	for _, tc := range cases {
+		e := NewExtractor(1, true)
+		e.Limits = tc.limits
+		err := e.ExtractAll(context.Background(), []string{zipPath}, filepath.Join(dir, tc.name))
+
+		var unsafe *UnsafeArchiveError
+		if !errors.As(err, &unsafe) {
+			t.Fatalf("%s: expected UnsafeArchiveError, got %v", tc.name, err)
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected %q in error, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestExtractAll_RejectsHighCompressionRatio(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "bomb.zip")
+	createTestZip(t, zipPath, map[string]string{
+		"zeros.csv": strings.Repeat("\x00", 4<<20),
+	})
+
+	err := NewExtractor(1, true).ExtractAll(context.Background(), []string{zipPath}, filepath.Join(dir, "out"))
+	if err == nil || !strings.Contains(err.Error(), "taxa de compressão") {
+		t.Fatalf("expected compression ratio rejection, got %v", err)
+	}
+}
+
+func TestEntryLimit(t *testing.T) {
+	t.Parallel()
+
+	f := &zip.File{FileHeader: zip.FileHeader{CompressedSize64: 100 << 10, UncompressedSize64: 1 << 10}}
+	cases := []struct {
+		name    string
+		limits  Limits
+		written int64
+		want    int64
+	}{
+		{"none", Limits{}, 0, -1},
+		{"entry", Limits{MaxEntryBytes: 50}, 0, 50},
+		{"total left", Limits{MaxEntryBytes: 50, MaxTotalBytes: 100}, 70, 30},
+		// 100 KiB compressed at 20:1 may produce 2000 KiB, whatever the header says
+		{"ratio", Limits{MaxEntryBytes: 20 << 30, MaxRatio: 20}, 0, 2000 << 10},
+		{"ratio floor", Limits{MaxRatio: 2}, 0, minRatioCheckBytes},
+	}
+	for _, tc := range cases {
+		if got := entryLimit(f, tc.limits, tc.written); got != tc.want {
+			t.Fatalf("%s: entryLimit = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLimitedCopy(t *testing.T) {
+	t.Parallel()
+
+	var sb strings.Builder
+	if _, err := limitedCopy(&sb, strings.NewReader("12345"), 5); err != nil {
+		t.Fatalf("copy within limit failed: %v", err)
+	}
+	if _, err := limitedCopy(&sb, strings.NewReader("123456"), 5); !errors.Is(err, errLimitExceeded) {
+		t.Fatalf("expected errLimitExceeded, got %v", err)
+	}
+	if _, err := limitedCopy(&sb, strings.NewReader("123456"), -1); err != nil {
+		t.Fatalf("unlimited copy failed: %v", err)
+	}
+}
@@ -20,11 +20,25 @@ type CopyResult struct {
 	Table string
 	File  string
 	Rows  int64
+	// Drift is set when records had a field count different from the spec.
+	Drift *Drift
+}
+
+type CopyOptions struct {
+	DriftPolicy DriftPolicy
+	// Filter keeps only the records whose column (key) has one of the listed
+	// values; records are kept when Filter is empty.
+	Filter map[string][]string
 }
 
 func EnsureTable(ctx context.Context, db *sql.DB, spec TableSpec, drop bool) error {
+	if spec.Schema != "" {
+		if _, err := db.ExecContext(ctx, `CREATE SCHEMA IF NOT EXISTS `+QuoteIdent(spec.Schema)+`;`); err != nil {
+			return err
+		}
+	}
 	if drop {
-		if _, err := db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS "%s";`, spec.Name)); err != nil {
+		if _, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS `+spec.Ident()+`;`); err != nil {
 			return err
 		}
 	}
@@ -34,10 +48,77 @@ func EnsureTable(ctx context.Context, db *sql.DB, spec TableSpec, drop bool) err
 	return nil
 }
 
+// StagingSuffix names the table a new generation is loaded into; it only
+// replaces the live table in SwapStaging.
+const StagingSuffix = "__new"
+
+// Staging is spec loading into its staging table.
+func (t TableSpec) Staging() TableSpec {
+	s := t
+	s.staging = true
+	return s
+}
+
+// CreateIndexes builds the indexes of spec (see CreateIndexSQL).
+func CreateIndexes(ctx context.Context, db *sql.DB, spec TableSpec) error {
+	for _, idx := range spec.Indexes {
+		if _, err := db.ExecContext(ctx, CreateIndexSQL(spec, idx)); err != nil {
+			return fmt.Errorf("índice %s: %w", idx.Name, err)
+		}
+	}
+	return nil
+}
+
+// ConvertColumns applies the ColumnTypes of spec (see AlterColumnTypesSQL).
+func ConvertColumns(ctx context.Context, db *sql.DB, spec TableSpec) error {
+	q := AlterColumnTypesSQL(spec)
+	if q == "" {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("converter colunas de %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// SwapStaging replaces the live table of spec by its staging table, and the
+// indexes built on it take the live names. Run it in the transaction that
+// records the load, so readers see either the old generation or the new one.
+func SwapStaging(ctx context.Context, tx *sql.Tx, spec TableSpec) error {
+	if _, err := tx.ExecContext(ctx, `DROP TABLE IF EXISTS `+spec.Ident()+`;`); err != nil {
+		return err
+	}
+	staged := spec.Staging()
+	if _, err := tx.ExecContext(ctx, `ALTER TABLE `+staged.Ident()+` RENAME TO `+QuoteIdent(spec.Relation())+`;`); err != nil {
+		return err
+	}
+	for _, idx := range spec.Indexes {
+		if _, err := tx.ExecContext(ctx, `ALTER INDEX IF EXISTS `+staged.qualified(staged.IndexName(idx))+` RENAME TO `+QuoteIdent(spec.IndexName(idx))+`;`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropStaging removes the staging table of spec left by a failed load.
+func DropStaging(ctx context.Context, db *sql.DB, spec TableSpec) error {
+	_, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS `+spec.Staging().Ident()+`;`)
+	return err
+}
+
+func (t TableSpec) pgxIdent() pgx.Identifier {
+	if t.Schema == "" {
+		return pgx.Identifier{t.Relation()}
+	}
+	return pgx.Identifier{t.Schema, t.Relation()}
+}
+
 // CopyCSV streams a ';' separated (latin-1) file into Postgres via pgx CopyFrom.
 // All columns are treated as TEXT.
 // This replaces pandas to_sql chunking with faster streaming.
-func CopyCSV(ctx context.Context, db *sql.DB, spec TableSpec, csvPath string) (CopyResult, error) {
+// Records with a field count different from the spec are handled according to
+// opts.DriftPolicy and summarized in CopyResult.Drift.
+func CopyCSV(ctx context.Context, db *sql.DB, spec TableSpec, csvPath string, opts CopyOptions) (CopyResult, error) {
 	sqlConn, err := db.Conn(ctx)
 	if err != nil {
 		return CopyResult{}, err
@@ -56,8 +137,28 @@ func CopyCSV(ctx context.Context, db *sql.DB, spec TableSpec, csvPath string) (C
 	reader.LazyQuotes = true
 
 	src := &csvCopySource{
-		r:       reader,
-		cols:    len(spec.Columns),
+		r:      reader,
+		cols:   len(spec.Columns),
+		policy: opts.DriftPolicy,
+		table:  spec.Name,
+		file:   csvPath,
+	}
+	if len(opts.Filter) > 0 {
+		src.filter = map[int]map[string]bool{}
+		for i, c := range spec.Columns {
+			vals, ok := opts.Filter[c]
+			if !ok {
+				continue
+			}
+			set := map[string]bool{}
+			for _, v := range vals {
+				set[v] = true
+			}
+			src.filter[i] = set
+		}
+		if len(src.filter) != len(opts.Filter) {
+			return CopyResult{}, fmt.Errorf("filtro de %s usa coluna inexistente", spec.Name)
+		}
 	}
 
 	var rows int64
@@ -67,24 +168,55 @@ func CopyCSV(ctx context.Context, db *sql.DB, spec TableSpec, csvPath string) (C
 			return fmt.Errorf("unexpected driver connection type %T", driverConn)
 		}
 		var copyErr error
-		rows, copyErr = stdConn.Conn().CopyFrom(ctx, pgx.Identifier{spec.Name}, spec.Columns, src)
+		rows, copyErr = stdConn.Conn().CopyFrom(ctx, spec.pgxIdent(), spec.Columns, src)
 		return copyErr
 	})
 	if err != nil {
 		return CopyResult{}, fmt.Errorf("copy %s (%s): %w", spec.Name, csvPath, err)
 	}
 
-	return CopyResult{Table: spec.Name, File: csvPath, Rows: rows}, nil
+	res := CopyResult{Table: spec.Name, File: csvPath, Rows: rows}
+	if opts.DriftPolicy != DriftIgnore && src.drift.Drifted() {
+		src.drift.Table, src.drift.File = spec.Name, csvPath
+		res.Drift = src.drift
+	}
+	return res, nil
 }
 
 type csvCopySource struct {
-	r    *csv.Reader
-	cols int
-	row  []string
-	err  error
+	r      *csv.Reader
+	cols   int
+	policy DriftPolicy
+	table  string
+	file   string
+	drift  *Drift
+	// filter is CopyOptions.Filter by column index
+	filter map[int]map[string]bool
+	row    []string
+	err    error
 }
 
 func (s *csvCopySource) Next() bool {
+	for {
+		if !s.next() {
+			return false
+		}
+		if s.keep() {
+			return true
+		}
+	}
+}
+
+func (s *csvCopySource) keep() bool {
+	for i, set := range s.filter {
+		if !set[strings.TrimSpace(s.row[i])] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *csvCopySource) next() bool {
 	rec, err := s.r.Read()
 	if err == io.EOF {
 		return false
@@ -94,6 +226,16 @@ func (s *csvCopySource) Next() bool {
 		return false
 	}
 
+	if s.drift == nil {
+		s.drift = newDrift(s.cols)
+	}
+	line, _ := s.r.FieldPos(0)
+	s.drift.observe(len(rec), line)
+	if len(rec) != s.cols && s.policy == DriftFail {
+		s.err = &DriftError{Table: s.table, File: s.file, Line: line, Expected: s.cols, Got: len(rec)}
+		return false
+	}
+
 	// Ajusta número de colunas: se vier menos, completa com "".
 	// Se vier mais, trunca.
 	if len(rec) < s.cols {
@@ -2,6 +2,7 @@ package loaders
 
 import (
 	"encoding/csv"
+	"errors"
 	"strings"
 	"testing"
 )
@@ -55,3 +56,72 @@ func TestCSVSource_Err(t *testing.T) {
 	}
 }
 
+func TestCSVSource_RecordsDrift(t *testing.T) {
+	t.Parallel()
+
+	reader := csv.NewReader(strings.NewReader("a;b\nx;y;z\nc;d\ne\n"))
+	reader.Comma = ';'
+	reader.FieldsPerRecord = -1
+
+	src := &csvCopySource{r: reader, cols: 2, policy: DriftWarn, table: "moti", file: "MOTICSV"}
+	rows := 0
+	for src.Next() {
+		rows++
+	}
+	if src.Err() != nil || rows != 4 {
+		t.Fatalf("expected 4 rows without error, got rows=%d err=%v", rows, src.Err())
+	}
+
+	d := src.drift
+	if !d.Drifted() {
+		t.Fatal("expected drift to be detected")
+	}
+	if d.Observed[2] != 2 || d.Observed[3] != 1 || d.Observed[1] != 1 {
+		t.Fatalf("unexpected observed counts: %v", d.Observed)
+	}
+	if len(d.Samples[3]) != 1 || d.Samples[3][0] != 2 {
+		t.Fatalf("unexpected sample lines: %v", d.Samples)
+	}
+	d.Table, d.File = "moti", "MOTICSV"
+	if !strings.Contains(d.String(), "esperado 2 colunas") || !strings.Contains(d.String(), "3 colunas em 1 linha(s) (ex.: linhas 2)") {
+		t.Fatalf("unexpected drift summary: %s", d)
+	}
+}
+
+func TestCSVSource_DriftFail(t *testing.T) {
+	t.Parallel()
+
+	reader := csv.NewReader(strings.NewReader("a;b\nx;y;z\n"))
+	reader.Comma = ';'
+	reader.FieldsPerRecord = -1
+
+	src := &csvCopySource{r: reader, cols: 2, policy: DriftFail, table: "moti", file: "MOTICSV"}
+	if !src.Next() {
+		t.Fatal("expected first row")
+	}
+	if src.Next() {
+		t.Fatal("expected Next=false on drifted record")
+	}
+	var de *DriftError
+	if !errors.As(src.Err(), &de) || de.Line != 2 || de.Got != 3 {
+		t.Fatalf("expected DriftError at line 2, got %v", src.Err())
+	}
+}
+
+func TestCSVSource_Filter(t *testing.T) {
+	t.Parallel()
+
+	reader := csv.NewReader(strings.NewReader("1;SP\n2;RJ\n3; SP \n"))
+	reader.Comma = ';'
+	reader.FieldsPerRecord = -1
+
+	src := &csvCopySource{r: reader, cols: 2, filter: map[int]map[string]bool{1: {"SP": true}}}
+	var got []any
+	for src.Next() {
+		v, _ := src.Values()
+		got = append(got, v[0])
+	}
+	if src.Err() != nil || len(got) != 2 || got[0] != "1" || got[1] != "3" {
+		t.Fatalf("unexpected filtered rows: %v (err %v)", got, src.Err())
+	}
+}
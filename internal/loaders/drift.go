@@ -0,0 +1,93 @@
+package loaders
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DriftPolicy says what CopyCSV does with records whose field count differs
+// from len(spec.Columns).
+type DriftPolicy string
+
+const (
+	// DriftWarn pads/truncates the record and reports the drift (default).
+	DriftWarn DriftPolicy = "warn"
+	// DriftFail aborts the copy at the first drifted record.
+	DriftFail DriftPolicy = "fail"
+	// DriftIgnore pads/truncates silently, as older versions did.
+	DriftIgnore DriftPolicy = "ignore"
+)
+
+// maxDriftSamples is how many line numbers are kept per unexpected count.
+const maxDriftSamples = 5
+
+// Drift summarizes the field counts seen in one file.
+type Drift struct {
+	Table    string        `json:"table"`
+	File     string        `json:"file"`
+	Expected int           `json:"expected"`
+	Observed map[int]int64 `json:"observed"`
+	// Samples keeps the first line numbers of each unexpected field count.
+	Samples map[int][]int `json:"samples"`
+}
+
+func newDrift(expected int) *Drift {
+	return &Drift{Expected: expected, Observed: map[int]int64{}, Samples: map[int][]int{}}
+}
+
+func (d *Drift) observe(fields, line int) {
+	d.Observed[fields]++
+	if fields != d.Expected && len(d.Samples[fields]) < maxDriftSamples {
+		d.Samples[fields] = append(d.Samples[fields], line)
+	}
+}
+
+// Drifted reports whether any record had an unexpected field count.
+func (d *Drift) Drifted() bool {
+	if d == nil {
+		return false
+	}
+	for fields := range d.Observed {
+		if fields != d.Expected {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Drift) String() string {
+	counts := make([]int, 0, len(d.Observed))
+	for fields := range d.Observed {
+		if fields != d.Expected {
+			counts = append(counts, fields)
+		}
+	}
+	sort.Ints(counts)
+
+	parts := make([]string, 0, len(counts))
+	for _, fields := range counts {
+		lines := make([]string, 0, len(d.Samples[fields]))
+		for _, l := range d.Samples[fields] {
+			lines = append(lines, fmt.Sprint(l))
+		}
+		parts = append(parts, fmt.Sprintf("%d colunas em %d linha(s) (ex.: linhas %s)",
+			fields, d.Observed[fields], strings.Join(lines, ", ")))
+	}
+	return fmt.Sprintf("%s (%s): esperado %d colunas; observado %s",
+		d.Table, d.File, d.Expected, strings.Join(parts, "; "))
+}
+
+// DriftError is returned by CopyCSV under DriftFail.
+type DriftError struct {
+	Table    string
+	File     string
+	Line     int
+	Expected int
+	Got      int
+}
+
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("layout de %s mudou em %s linha %d: esperado %d colunas, encontrado %d",
+		e.Table, e.File, e.Line, e.Expected, e.Got)
+}
@@ -1,26 +1,151 @@
 package loaders
 
-import "strings"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
 
 type TableSpec struct {
 	Name    string
 	Columns []string
+	// Patterns are regular expressions (column -> pattern) that values of the
+	// column are expected to match. They are used to recognize a file by its
+	// content; columns without a pattern accept anything. Tables with the same
+	// columns and patterns can't be told apart by content: moti and quals
+	// (codes of 1-2 digits) and munic and natju (4 digits).
+	Patterns map[string]string
+	// Schema is the Postgres schema of the table; empty uses the search_path.
+	Schema string
+	// Prefix and Suffix surround Name in the table and index names, so that
+	// several loaders can share a schema.
+	Prefix string
+	Suffix string
+	// Indexes are created on the staging table before the swap.
+	Indexes []Index
+	// ColumnTypes (column -> Postgres type) are applied after the load;
+	// columns without a type stay TEXT.
+	ColumnTypes map[string]string
+
+	// staging is set by Staging
+	staging bool
+}
+
+type Index struct {
+	Name    string
+	Columns []string
+}
+
+// Lookup returns the spec of a known table.
+func Lookup(name string) (TableSpec, bool) {
+	for _, s := range All {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return TableSpec{}, false
+}
+
+// HasColumn reports whether col is one of the spec columns.
+func (t TableSpec) HasColumn(col string) bool {
+	for _, c := range t.Columns {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+// Relation is the name of the table in the database: Name with Prefix and
+// Suffix, plus StagingSuffix for the staging table.
+func (t TableSpec) Relation() string { return t.physical(t.Name) }
+
+// IndexName is the name of idx in the database, named like Relation.
+func (t TableSpec) IndexName(idx Index) string { return t.physical(idx.Name) }
+
+func (t TableSpec) physical(name string) string {
+	name = t.Prefix + name + t.Suffix
+	if t.staging {
+		name += StagingSuffix
+	}
+	return name
 }
 
-// All columns as TEXT for resilience (parsing can be added later).
+// Ident is the quoted, schema-qualified Relation.
+func (t TableSpec) Ident() string { return t.qualified(t.Relation()) }
+
+func (t TableSpec) qualified(name string) string { return QualifiedIdent(t.Schema, name) }
+
+// QualifiedIdent is the quoted name, qualified with schema when it is set.
+func QualifiedIdent(schema, name string) string {
+	if schema == "" {
+		return QuoteIdent(name)
+	}
+	return QuoteIdent(schema) + "." + QuoteIdent(name)
+}
+
+// QuoteIdent quotes a Postgres identifier.
+func QuoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// All columns as TEXT for resilience; ColumnTypes converts them after the load.
 func CreateTableSQL(t TableSpec) string {
 	var sb strings.Builder
-	sb.WriteString(`CREATE TABLE IF NOT EXISTS "`)
-	sb.WriteString(t.Name)
-	sb.WriteString(`" (`)
+	sb.WriteString(`CREATE TABLE IF NOT EXISTS `)
+	sb.WriteString(t.Ident())
+	sb.WriteString(` (`)
 	for i, c := range t.Columns {
 		if i > 0 {
 			sb.WriteString(",")
 		}
-		sb.WriteString(`"`)
-		sb.WriteString(c)
-		sb.WriteString(`" TEXT`)
+		sb.WriteString(QuoteIdent(c))
+		sb.WriteString(` TEXT`)
 	}
 	sb.WriteString(");")
 	return sb.String()
 }
+
+// CreateIndexSQL builds idx on t, named by IndexName.
+func CreateIndexSQL(t TableSpec, idx Index) string {
+	cols := make([]string, len(idx.Columns))
+	for i, c := range idx.Columns {
+		cols[i] = QuoteIdent(c)
+	}
+	return fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (%s);`, QuoteIdent(t.IndexName(idx)), t.Ident(), strings.Join(cols, ", "))
+}
+
+var reColumnType = regexp.MustCompile(`^(?i)(text|varchar(\(\d+\))?|char(\(\d+\))?|smallint|integer|int|bigint|numeric(\(\d+(,\s*\d+)?\))?|real|double precision|date|boolean)$`)
+
+// ValidColumnType reports whether typ can be used in ColumnTypes.
+func ValidColumnType(typ string) bool { return reColumnType.MatchString(strings.TrimSpace(typ)) }
+
+// AlterColumnTypesSQL converts the ColumnTypes of t in one statement. Empty
+// values become NULL; numbers use the decimal comma of the source files and
+// dates are AAAAMMDD, with "0" and "00000000" meaning no date.
+func AlterColumnTypesSQL(t TableSpec) string {
+	var parts []string
+	for _, c := range t.Columns {
+		typ, ok := t.ColumnTypes[c]
+		if !ok {
+			continue
+		}
+		typ = strings.ToLower(strings.TrimSpace(typ))
+		v := fmt.Sprintf(`nullif(trim(%s), '')`, QuoteIdent(c))
+		switch {
+		case typ == "date":
+			v = fmt.Sprintf(`to_date(nullif(nullif(%s, '0'), '00000000'), 'YYYYMMDD')`, v)
+		case strings.HasPrefix(typ, "numeric"), typ == "real", typ == "double precision":
+			v = fmt.Sprintf(`replace(%s, ',', '.')::%s`, v, typ)
+		case typ == "boolean":
+			v = fmt.Sprintf(`(upper(%s) IN ('S', 'SIM', 'TRUE', '1'))`, v)
+		default:
+			v += "::" + typ
+		}
+		parts = append(parts, fmt.Sprintf(`ALTER COLUMN %s TYPE %s USING %s`, QuoteIdent(c), typ, v))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return `ALTER TABLE ` + t.Ident() + ` ` + strings.Join(parts, ", ") + `;`
+}
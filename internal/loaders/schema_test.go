@@ -24,3 +24,63 @@ func TestCreateTableSQL(t *testing.T) {
 	}
 }
 
+func TestTableSpec_Staging(t *testing.T) {
+	t.Parallel()
+
+	s := Moti.Staging()
+	if s.Relation() != "moti__new" || s.Name != "moti" || Moti.Relation() != "moti" {
+		t.Fatalf("unexpected staging relation %q (live %q)", s.Relation(), Moti.Relation())
+	}
+	if !strings.Contains(CreateTableSQL(s), `"moti__new"`) {
+		t.Fatalf("staging table not used in SQL: %s", CreateTableSQL(s))
+	}
+}
+
+func TestTableSpec_SchemaIndexesAndTypes(t *testing.T) {
+	t.Parallel()
+
+	s := Empresa
+	s.Schema = "rfb"
+	s.ColumnTypes = map[string]string{"capital_social": "numeric", "cnpj_basico": "bigint"}
+
+	if got := CreateTableSQL(s.Staging()); !strings.Contains(got, `"rfb"."empresa__new"`) {
+		t.Fatalf("schema not used in SQL: %s", got)
+	}
+	idx := CreateIndexSQL(s.Staging(), s.Indexes[0])
+	if idx != `CREATE INDEX IF NOT EXISTS "empresa_cnpj__new" ON "rfb"."empresa__new" ("cnpj_basico");` {
+		t.Fatalf("unexpected index SQL: %s", idx)
+	}
+	alter := AlterColumnTypesSQL(s)
+	for _, want := range []string{
+		`ALTER TABLE "rfb"."empresa" `,
+		`ALTER COLUMN "cnpj_basico" TYPE bigint USING nullif(trim("cnpj_basico"), '')::bigint`,
+		`ALTER COLUMN "capital_social" TYPE numeric USING replace(nullif(trim("capital_social"), ''), ',', '.')::numeric`,
+	} {
+		if !strings.Contains(alter, want) {
+			t.Fatalf("expected %q in %s", want, alter)
+		}
+	}
+	if AlterColumnTypesSQL(Moti) != "" {
+		t.Fatal("expected no ALTER without column types")
+	}
+	if !ValidColumnType("numeric(18, 2)") || ValidColumnType("text; drop table x") {
+		t.Fatal("unexpected column type validation")
+	}
+}
+
+func TestTableSpec_PrefixAndSuffix(t *testing.T) {
+	t.Parallel()
+
+	s := Socios
+	s.Schema, s.Prefix, s.Suffix = "shared", "stg_", "_v2"
+
+	if got := s.Staging().Ident(); got != `"shared"."stg_socios_v2__new"` {
+		t.Fatalf("unexpected staging ident %s", got)
+	}
+	if got := CreateIndexSQL(s, s.Indexes[0]); got != `CREATE INDEX IF NOT EXISTS "stg_socios_cnpj_v2" ON "shared"."stg_socios_v2" ("cnpj_basico");` {
+		t.Fatalf("unexpected index SQL %s", got)
+	}
+	if got := s.Staging().pgxIdent().Sanitize(); got != `"shared"."stg_socios_v2__new"` {
+		t.Fatalf("unexpected copy target %s", got)
+	}
+}
@@ -1,5 +1,11 @@
 package loaders
 
+const (
+	reCNPJBasico = `^\d{8}$`
+	// datas AAAAMMDD; "0" e "00000000" aparecem como data vazia
+	reData = `^(\d{8}|0|)$`
+)
+
 var (
 	Empresa = TableSpec{
 		Name: "empresa",
@@ -12,53 +18,98 @@ var (
 			"porte_empresa",
 			"ente_federativo_responsavel",
 		},
+		Patterns: map[string]string{
+			"cnpj_basico":              reCNPJBasico,
+			"natureza_juridica":        `^\d{4}$`,
+			"qualificacao_responsavel": `^\d{1,2}$`,
+			"capital_social":           `^\d+(,\d+)?$`,
+		},
+		Indexes: cnpjIndex("empresa"),
 	}
 	Estabelecimento = TableSpec{
 		Name: "estabelecimento",
 		Columns: []string{
-			"cnpj_basico","cnpj_ordem","cnpj_dv","identificador_matriz_filial","nome_fantasia","situacao_cadastral",
-			"data_situacao_cadastral","motivo_situacao_cadastral","nome_cidade_exterior","pais","data_inicio_atividade",
-			"cnae_fiscal_principal","cnae_fiscal_secundaria","tipo_logradouro","logradouro","numero","complemento","bairro",
-			"cep","uf","municipio","ddd_1","telefone_1","ddd_2","telefone_2","ddd_fax","fax","correio_eletronico",
-			"situacao_especial","data_situacao_especial",
+			"cnpj_basico", "cnpj_ordem", "cnpj_dv", "identificador_matriz_filial", "nome_fantasia", "situacao_cadastral",
+			"data_situacao_cadastral", "motivo_situacao_cadastral", "nome_cidade_exterior", "pais", "data_inicio_atividade",
+			"cnae_fiscal_principal", "cnae_fiscal_secundaria", "tipo_logradouro", "logradouro", "numero", "complemento", "bairro",
+			"cep", "uf", "municipio", "ddd_1", "telefone_1", "ddd_2", "telefone_2", "ddd_fax", "fax", "correio_eletronico",
+			"situacao_especial", "data_situacao_especial",
+		},
+		Patterns: map[string]string{
+			"cnpj_basico":                 reCNPJBasico,
+			"cnpj_ordem":                  `^\d{4}$`,
+			"cnpj_dv":                     `^\d{2}$`,
+			"identificador_matriz_filial": `^[12]$`,
+			"data_situacao_cadastral":     reData,
 		},
+		Indexes: cnpjIndex("estabelecimento"),
 	}
 	Socios = TableSpec{
 		Name: "socios",
 		Columns: []string{
-			"cnpj_basico","identificador_socio","nome_socio_razao_social","cpf_cnpj_socio","qualificacao_socio",
-			"data_entrada_sociedade","pais","representante_legal","nome_do_representante","qualificacao_representante_legal",
+			"cnpj_basico", "identificador_socio", "nome_socio_razao_social", "cpf_cnpj_socio", "qualificacao_socio",
+			"data_entrada_sociedade", "pais", "representante_legal", "nome_do_representante", "qualificacao_representante_legal",
 			"faixa_etaria",
 		},
+		Patterns: map[string]string{
+			"cnpj_basico":         reCNPJBasico,
+			"identificador_socio": `^[123]$`,
+			"faixa_etaria":        `^\d$`,
+		},
+		Indexes: cnpjIndex("socios"),
 	}
 	Simples = TableSpec{
 		Name: "simples",
 		Columns: []string{
-			"cnpj_basico","opcao_pelo_simples","data_opcao_simples","data_exclusao_simples","opcao_mei","data_opcao_mei","data_exclusao_mei",
+			"cnpj_basico", "opcao_pelo_simples", "data_opcao_simples", "data_exclusao_simples", "opcao_mei", "data_opcao_mei", "data_exclusao_mei",
+		},
+		Patterns: map[string]string{
+			"cnpj_basico":        reCNPJBasico,
+			"opcao_pelo_simples": `^[SN]?$`,
+			"data_opcao_simples": reData,
+			"opcao_mei":          `^[SN]?$`,
 		},
+		Indexes: cnpjIndex("simples"),
 	}
 	Cnae = TableSpec{
-		Name: "cnae",
-		Columns: []string{"codigo","descricao"},
+		Name:     "cnae",
+		Columns:  []string{"codigo", "descricao"},
+		Patterns: map[string]string{"codigo": `^\d{7}$`},
 	}
 	Moti = TableSpec{
-		Name: "moti",
-		Columns: []string{"codigo","descricao"},
+		Name:     "moti",
+		Columns:  []string{"codigo", "descricao"},
+		Patterns: map[string]string{"codigo": `^\d{1,2}$`},
 	}
 	Munic = TableSpec{
-		Name: "munic",
-		Columns: []string{"codigo","descricao"},
+		Name:     "munic",
+		Columns:  []string{"codigo", "descricao"},
+		Patterns: map[string]string{"codigo": `^\d{4}$`},
 	}
 	Natju = TableSpec{
-		Name: "natju",
-		Columns: []string{"codigo","descricao"},
+		Name:     "natju",
+		Columns:  []string{"codigo", "descricao"},
+		Patterns: map[string]string{"codigo": `^\d{4}$`},
 	}
 	Pais = TableSpec{
-		Name: "pais",
-		Columns: []string{"codigo","descricao"},
+		Name:     "pais",
+		Columns:  []string{"codigo", "descricao"},
+		Patterns: map[string]string{"codigo": `^\d{3}$`},
 	}
 	Quals = TableSpec{
-		Name: "quals",
-		Columns: []string{"codigo","descricao"},
+		Name:     "quals",
+		Columns:  []string{"codigo", "descricao"},
+		Patterns: map[string]string{"codigo": `^\d{1,2}$`},
 	}
 )
+
+// cnpjIndex is the index on cnpj_basico created with CREATE_INDEXES.
+func cnpjIndex(table string) []Index {
+	return []Index{{Name: table + "_cnpj", Columns: []string{"cnpj_basico"}}}
+}
+
+// All lists every known table, in load order.
+var All = []TableSpec{
+	Empresa, Estabelecimento, Socios, Simples, Cnae,
+	Moti, Munic, Natju, Pais, Quals,
+}
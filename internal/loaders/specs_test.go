@@ -1,6 +1,9 @@
 package loaders
 
-import "testing"
+import (
+	"regexp"
+	"testing"
+)
 
 func TestTableSpecs_AreDefined(t *testing.T) {
 	t.Parallel()
@@ -20,3 +23,21 @@ func TestTableSpecs_AreDefined(t *testing.T) {
 	}
 }
 
+func TestTableSpecs_PatternsCompileAndNameColumns(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range All {
+		cols := map[string]bool{}
+		for _, c := range s.Columns {
+			cols[c] = true
+		}
+		for col, pat := range s.Patterns {
+			if !cols[col] {
+				t.Fatalf("spec %s: pattern for unknown column %s", s.Name, col)
+			}
+			if _, err := regexp.Compile(pat); err != nil {
+				t.Fatalf("spec %s: invalid pattern for %s: %v", s.Name, col, err)
+			}
+		}
+	}
+}
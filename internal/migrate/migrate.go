@@ -0,0 +1,227 @@
+// Package migrate versions the loader's own tables (rfcnpj_meta,
+// rfcnpj_runs, ...). Migrations are the embedded files sql/NNNN_name.sql,
+// applied in order, each in its own transaction, and recorded in
+// rfcnpj_schema_migrations. A migration is never edited once released: a
+// change to the schema is a new file.
+//
+// The tables live in one schema (TARGET_SCHEMA). The migration files don't
+// name it: they run with the search_path set to it, so each schema has its
+// own tables whatever DB_SEARCH_PATH says. An empty schema leaves them to the
+// search_path.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Table records the applied migrations.
+const Table = "rfcnpj_schema_migrations"
+
+type Migration struct {
+	Version  int
+	Name     string
+	SQL      string
+	Checksum string
+}
+
+// All returns the embedded migrations sorted by version.
+func All() ([]Migration, error) {
+	return load(files, "sql")
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	seen := map[int]string{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		num, rest, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), "_")
+		v, err := strconv.Atoi(num)
+		if !ok || err != nil || v <= 0 {
+			return nil, fmt.Errorf("migração com nome inválido: %s (esperado NNNN_nome.sql)", name)
+		}
+		if prev, dup := seen[v]; dup {
+			return nil, fmt.Errorf("migrações com a mesma versão %d: %s e %s", v, prev, name)
+		}
+		seen[v] = name
+		b, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(b)
+		out = append(out, Migration{Version: v, Name: rest, SQL: string(b), Checksum: hex.EncodeToString(sum[:])})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Status is a migration and whether the database has it.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the applied checksum differs from the embedded file.
+	Modified bool
+}
+
+// Report compares the embedded migrations with a database. Unknown lists
+// versions the database has and this build doesn't (it was migrated by a
+// newer loader).
+type Report struct {
+	Migrations []Status
+	Unknown    []int
+}
+
+// Pending is the number of migrations not applied yet.
+func (r Report) Pending() int {
+	n := 0
+	for _, m := range r.Migrations {
+		if !m.Applied {
+			n++
+		}
+	}
+	return n
+}
+
+func ensureTable(ctx context.Context, db *sql.DB, schema string) error {
+	_, err := db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS `+loaders.QualifiedIdent(schema, Table)+` (
+  version integer PRIMARY KEY,
+  name text NOT NULL,
+  checksum text NOT NULL,
+  applied_at timestamptz NOT NULL DEFAULT now()
+);`)
+	return err
+}
+
+type applied struct {
+	checksum string
+	at       time.Time
+}
+
+// Check compares the embedded migrations with the database, for the tables
+// of schema. It only reads: when the tracking table doesn't exist, nothing is
+// applied.
+func Check(ctx context.Context, db *sql.DB, schema string) (Report, error) {
+	table := loaders.QualifiedIdent(schema, Table)
+	all, err := All()
+	if err != nil {
+		return Report{}, err
+	}
+	done := map[int]applied{}
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+		return Report{}, err
+	}
+	if exists {
+		rows, err := db.QueryContext(ctx, `SELECT version, checksum, applied_at FROM `+table)
+		if err != nil {
+			return Report{}, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				v int
+				a applied
+			)
+			if err := rows.Scan(&v, &a.checksum, &a.at); err != nil {
+				return Report{}, err
+			}
+			done[v] = a
+		}
+		if err := rows.Err(); err != nil {
+			return Report{}, err
+		}
+	}
+
+	var rep Report
+	for _, m := range all {
+		st := Status{Migration: m}
+		if a, ok := done[m.Version]; ok {
+			st.Applied, st.AppliedAt, st.Modified = true, a.at, a.checksum != m.Checksum
+			delete(done, m.Version)
+		}
+		rep.Migrations = append(rep.Migrations, st)
+	}
+	for v := range done {
+		rep.Unknown = append(rep.Unknown, v)
+	}
+	sort.Ints(rep.Unknown)
+	return rep, nil
+}
+
+// Up applies the pending migrations and returns them. The caller must hold
+// the loader lock, so two instances don't migrate at once. It refuses to run
+// against a database migrated by a newer loader. schema must exist.
+func Up(ctx context.Context, db *sql.DB, schema string) ([]Migration, error) {
+	if err := ensureTable(ctx, db, schema); err != nil {
+		return nil, err
+	}
+	rep, err := Check(ctx, db, schema)
+	if err != nil {
+		return nil, err
+	}
+	if len(rep.Unknown) > 0 {
+		return nil, fmt.Errorf("o banco tem migrações desconhecidas %v: ele foi atualizado por uma versão mais nova do loader", rep.Unknown)
+	}
+
+	var out []Migration
+	for _, st := range rep.Migrations {
+		if st.Applied {
+			if st.Modified {
+				slog.Warn("applied migration differs from the embedded one", "version", st.Version, "name", st.Name)
+			}
+			continue
+		}
+		if err := apply(ctx, db, schema, st.Migration); err != nil {
+			return out, fmt.Errorf("migração %04d_%s: %w", st.Version, st.Name, err)
+		}
+		slog.Info("migration applied", "version", st.Version, "name", st.Name)
+		out = append(out, st.Migration)
+	}
+	return out, nil
+}
+
+func apply(ctx context.Context, db *sql.DB, schema string, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if schema != "" {
+		// só nesta transação: os nomes sem schema da migração caem em schema
+		if _, err := tx.ExecContext(ctx, `SET LOCAL search_path TO `+loaders.QuoteIdent(schema)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+loaders.QualifiedIdent(schema, Table)+`(version, name, checksum) VALUES ($1,$2,$3)`, m.Version, m.Name, m.Checksum); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,62 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAll_Embedded(t *testing.T) {
+	t.Parallel()
+
+	all, err := All()
+	if err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(all) < 2 || all[0].Version != 1 || all[0].Name != "meta" {
+		t.Fatalf("unexpected migrations %+v", all)
+	}
+	for i, m := range all {
+		if m.Version != i+1 {
+			t.Fatalf("migration versions must be contiguous: %d at %d", m.Version, i)
+		}
+		if len(m.Checksum) != 64 || strings.TrimSpace(m.SQL) == "" {
+			t.Fatalf("bad migration %04d_%s", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoad_SortsAndValidates(t *testing.T) {
+	t.Parallel()
+
+	got, err := load(fstest.MapFS{
+		"m/0010_b.sql": {Data: []byte("SELECT 2;")},
+		"m/0002_a.sql": {Data: []byte("SELECT 1;")},
+		"m/README":     {Data: []byte("x")},
+	}, "m")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(got) != 2 || got[0].Version != 2 || got[1].Name != "b" {
+		t.Fatalf("unexpected order %+v", got)
+	}
+
+	if _, err := load(fstest.MapFS{"m/x_a.sql": {Data: []byte("")}}, "m"); err == nil {
+		t.Fatalf("expected error for invalid name")
+	}
+	if _, err := load(fstest.MapFS{
+		"m/0001_a.sql": {Data: []byte("")},
+		"m/001_b.sql":  {Data: []byte("")},
+	}, "m"); err == nil {
+		t.Fatalf("expected error for duplicated version")
+	}
+}
+
+func TestReport_Pending(t *testing.T) {
+	t.Parallel()
+
+	r := Report{Migrations: []Status{{Applied: true}, {}, {}}}
+	if r.Pending() != 2 {
+		t.Fatalf("expected 2 pending, got %d", r.Pending())
+	}
+}
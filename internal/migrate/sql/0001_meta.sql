@@ -0,0 +1,6 @@
+-- chave/valor com o estado das cargas (loaded_month, loaded_month_<tabela>, ...)
+CREATE TABLE IF NOT EXISTS rfcnpj_meta (
+  key text PRIMARY KEY,
+  value text NOT NULL,
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,22 @@
+-- histórico das execuções e de suas etapas
+CREATE TABLE IF NOT EXISTS rfcnpj_runs (
+  id bigserial PRIMARY KEY,
+  trigger text NOT NULL DEFAULT '',
+  month text NOT NULL DEFAULT '',
+  status text NOT NULL,
+  started_at timestamptz NOT NULL,
+  finished_at timestamptz,
+  bytes_downloaded bigint NOT NULL DEFAULT 0,
+  table_rows jsonb NOT NULL DEFAULT '{}',
+  error text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS rfcnpj_run_stages (
+  run_id bigint NOT NULL REFERENCES rfcnpj_runs(id) ON DELETE CASCADE,
+  stage text NOT NULL,
+  status text NOT NULL,
+  started_at timestamptz NOT NULL,
+  finished_at timestamptz,
+  error text NOT NULL DEFAULT '',
+  PRIMARY KEY (run_id, stage)
+);
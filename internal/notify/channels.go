@@ -0,0 +1,179 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/email"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the webhook body, as
+// "sha256=<hex>", when a secret is configured.
+const SignatureHeader = "X-RFCNPJ-Signature"
+
+// SMTP sends events as e-mail.
+type SMTP struct {
+	Config email.SMTPConfig
+}
+
+func (s *SMTP) Name() string { return "smtp" }
+
+func (s *SMTP) Notify(_ context.Context, ev Event) error {
+	return email.Send(s.Config, email.Message{Subject: ev.Subject, Text: ev.Text, HTML: ev.HTML, Attachments: ev.Attachments})
+}
+
+// Webhook posts the event as JSON to URL. When Secret is set the body is
+// signed with HMAC-SHA256 in SignatureHeader.
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+type webhookPayload struct {
+	Event   Kind      `json:"event"`
+	Month   string    `json:"month,omitempty"`
+	Subject string    `json:"subject"`
+	Text    string    `json:"text"`
+	Time    time.Time `json:"time"`
+	// Report is the run report (see package report), when available.
+	Report json.RawMessage `json:"report,omitempty"`
+}
+
+func (w *Webhook) Name() string { return "webhook" }
+
+func (w *Webhook) Notify(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(webhookPayload{Event: ev.Kind, Month: ev.Month, Subject: ev.Subject, Text: ev.Text, Time: ev.Time, Report: ev.Report})
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	if w.Secret != "" {
+		header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+	return expect2xx(postJSON(ctx, w.Client, w.URL, body, header))
+}
+
+// Sign returns the SignatureHeader value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Slack posts to a Slack-compatible incoming webhook (Slack, Mattermost,
+// Rocket.Chat, Teams via connector...).
+type Slack struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *Slack) Name() string { return "slack" }
+
+func (s *Slack) Notify(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(map[string]string{"text": "*" + ev.Subject + "*\n" + ev.Text})
+	if err != nil {
+		return err
+	}
+	return expect2xx(postJSON(ctx, s.Client, s.URL, body, nil))
+}
+
+// DefaultTelegramAPIURL is the Telegram Bot API endpoint.
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+// telegramMaxText is the sendMessage text limit.
+const telegramMaxText = 4096
+
+// Telegram sends the event with the Bot API sendMessage method.
+type Telegram struct {
+	Token  string
+	ChatID string
+	// APIURL defaults to DefaultTelegramAPIURL.
+	APIURL string
+	Client *http.Client
+}
+
+func (t *Telegram) Name() string { return "telegram" }
+
+func (t *Telegram) Notify(ctx context.Context, ev Event) error {
+	text := ev.Subject + "\n\n" + ev.Text
+	if r := []rune(text); len(r) > telegramMaxText {
+		text = string(r[:telegramMaxText-1]) + "…"
+	}
+	body, err := json.Marshal(map[string]any{
+		"chat_id":                  t.ChatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	api := strings.TrimRight(t.APIURL, "/")
+	if api == "" {
+		api = DefaultTelegramAPIURL
+	}
+	status, resp, err := postJSON(ctx, t.Client, api+"/bot"+t.Token+"/sendMessage", body, nil)
+	if err != nil {
+		// a URL do bot contém o token; não deixa vazar no log
+		return errors.New(strings.ReplaceAll(err.Error(), t.Token, "<token>"))
+	}
+	// erros da API (4xx) vêm com {"ok":false,"description":...}
+	var out struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return fmt.Errorf("telegram: status %d: resposta inválida: %w", status, err)
+	}
+	if !out.OK {
+		return fmt.Errorf("telegram: %s", out.Description)
+	}
+	return nil
+}
+
+// postJSON posts body and returns the response status and (truncated) body.
+// Only transport errors are returned as err.
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) (int, []byte, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "rfcnpj-loader")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, b, err
+}
+
+func expect2xx(status int, body []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	if status < 200 || status > 299 {
+		return fmt.Errorf("status %d: %s", status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/email"
+)
+
+// Kind is the pipeline event a notification is about.
+type Kind string
+
+const (
+	KindStarted  Kind = "started"
+	KindUpToDate Kind = "up_to_date"
+	KindFinished Kind = "finished"
+	KindFailed   Kind = "failed"
+)
+
+var kinds = []Kind{KindStarted, KindUpToDate, KindFinished, KindFailed}
+
+// Event is what every channel receives. Text is the full plain-text body;
+// HTML is optional and only used by channels that can show it (e-mail).
+type Event struct {
+	Kind    Kind
+	Month   string
+	Subject string
+	Text    string
+	HTML    string
+	Time    time.Time
+	// Report is the JSON run report, sent as is by the webhook channel.
+	Report []byte
+	// Attachments are only used by channels that support them (e-mail).
+	Attachments []email.Attachment
+}
+
+// Notifier is one notification channel.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, ev Event) error
+}
+
+// Multi fans every event out to all its channels. Events whose kind is not in
+// Kinds are dropped (a nil Kinds lets everything through).
+type Multi struct {
+	Channels []Notifier
+	Kinds    map[Kind]bool
+}
+
+func (m *Multi) Name() string { return "multi" }
+
+// Enabled reports whether there is at least one channel configured.
+func (m *Multi) Enabled() bool { return m != nil && len(m.Channels) > 0 }
+
+// Notify sends ev to every channel, even when some of them fail, and returns
+// the joined errors prefixed by the channel name.
+func (m *Multi) Notify(ctx context.Context, ev Event) error {
+	if !m.Enabled() || (m.Kinds != nil && !m.Kinds[ev.Kind]) {
+		return nil
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	var errs []error
+	for _, ch := range m.Channels {
+		if err := ch.Notify(ctx, ev); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ch.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseKinds parses a comma separated list of event kinds.
+func ParseKinds(s string) (map[Kind]bool, error) {
+	out := map[Kind]bool{}
+	for _, part := range strings.Split(s, ",") {
+		k := Kind(strings.ToLower(strings.TrimSpace(part)))
+		if k == "" {
+			continue
+		}
+		known := false
+		for _, kk := range kinds {
+			if k == kk {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("evento de notificação desconhecido: %q", k)
+		}
+		out[k] = true
+	}
+	return out, nil
+}
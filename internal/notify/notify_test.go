@@ -0,0 +1,218 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorded struct {
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// recorder is an httptest server that stores every request and answers with
+// status and body.
+func recorder(t *testing.T, status int, body string) (*httptest.Server, func() []recorded) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		reqs []recorded
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		reqs = append(reqs, recorded{Path: r.URL.Path, Header: r.Header.Clone(), Body: b})
+		mu.Unlock()
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []recorded {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recorded(nil), reqs...)
+	}
+}
+
+var testEvent = Event{
+	Kind:    KindFinished,
+	Month:   "2026-01",
+	Subject: "RFCNPJ Loader finalizado - 2026-01",
+	Text:    "Linhas carregadas por tabela:\n- empresa: 10",
+	Time:    time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC),
+	Report:  []byte(`{"schema_version":1,"status":"loaded"}`),
+}
+
+func TestWebhook_SignsBody(t *testing.T) {
+	t.Parallel()
+
+	srv, reqs := recorder(t, http.StatusNoContent, "")
+	w := &Webhook{URL: srv.URL + "/hook", Secret: "s3cret"}
+	if err := w.Notify(context.Background(), testEvent); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	got := reqs()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(got))
+	}
+	if sig := got[0].Header.Get(SignatureHeader); sig != Sign("s3cret", got[0].Body) {
+		t.Fatalf("bad signature %q", sig)
+	}
+	var p webhookPayload
+	if err := json.Unmarshal(got[0].Body, &p); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if p.Event != KindFinished || p.Month != "2026-01" || p.Text != testEvent.Text {
+		t.Fatalf("unexpected payload: %+v", p)
+	}
+	if string(p.Report) != string(testEvent.Report) {
+		t.Fatalf("unexpected report %s", p.Report)
+	}
+}
+
+func TestWebhook_NoSecretNoSignature(t *testing.T) {
+	t.Parallel()
+
+	srv, reqs := recorder(t, http.StatusOK, "")
+	if err := (&Webhook{URL: srv.URL}).Notify(context.Background(), testEvent); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if sig := reqs()[0].Header.Get(SignatureHeader); sig != "" {
+		t.Fatalf("unexpected signature %q", sig)
+	}
+}
+
+func TestSlack_PostsText(t *testing.T) {
+	t.Parallel()
+
+	srv, reqs := recorder(t, http.StatusOK, "ok")
+	if err := (&Slack{URL: srv.URL}).Notify(context.Background(), testEvent); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	var p map[string]string
+	if err := json.Unmarshal(reqs()[0].Body, &p); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if !strings.HasPrefix(p["text"], "*"+testEvent.Subject+"*\n") || !strings.Contains(p["text"], "- empresa: 10") {
+		t.Fatalf("unexpected text %q", p["text"])
+	}
+}
+
+func TestSlack_StatusError(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := recorder(t, http.StatusForbidden, "invalid_token")
+	err := (&Slack{URL: srv.URL}).Notify(context.Background(), testEvent)
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "invalid_token") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
+
+func TestTelegram_SendMessage(t *testing.T) {
+	t.Parallel()
+
+	srv, reqs := recorder(t, http.StatusOK, `{"ok":true,"result":{}}`)
+	tg := &Telegram{Token: "123:abc", ChatID: "-100", APIURL: srv.URL}
+	if err := tg.Notify(context.Background(), testEvent); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	got := reqs()[0]
+	if got.Path != "/bot123:abc/sendMessage" {
+		t.Fatalf("unexpected path %q", got.Path)
+	}
+	var p map[string]any
+	if err := json.Unmarshal(got.Body, &p); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if p["chat_id"] != "-100" || !strings.HasPrefix(p["text"].(string), testEvent.Subject+"\n\n") {
+		t.Fatalf("unexpected payload %v", p)
+	}
+}
+
+func TestTelegram_APIError(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := recorder(t, http.StatusBadRequest, `{"ok":false,"description":"Bad Request: chat not found"}`)
+	err := (&Telegram{Token: "123:abc", ChatID: "x", APIURL: srv.URL}).Notify(context.Background(), testEvent)
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Fatalf("expected api error, got %v", err)
+	}
+}
+
+func TestTelegram_TransportErrorHidesToken(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := recorder(t, http.StatusOK, "")
+	srv.Close()
+	err := (&Telegram{Token: "123:abc", ChatID: "x", APIURL: srv.URL}).Notify(context.Background(), testEvent)
+	if err == nil || strings.Contains(err.Error(), "123:abc") {
+		t.Fatalf("expected error without token, got %v", err)
+	}
+}
+
+type fakeNotifier struct {
+	name string
+	err  error
+	got  []Event
+}
+
+func (f *fakeNotifier) Name() string { return f.name }
+
+func (f *fakeNotifier) Notify(_ context.Context, ev Event) error {
+	f.got = append(f.got, ev)
+	return f.err
+}
+
+func TestMulti_FansOutAndJoinsErrors(t *testing.T) {
+	t.Parallel()
+
+	a := &fakeNotifier{name: "a", err: errors.New("boom")}
+	b := &fakeNotifier{name: "b"}
+	m := &Multi{Channels: []Notifier{a, b}}
+
+	err := m.Notify(context.Background(), testEvent)
+	if err == nil || !strings.Contains(err.Error(), "a: boom") {
+		t.Fatalf("expected joined error, got %v", err)
+	}
+	if len(a.got) != 1 || len(b.got) != 1 {
+		t.Fatalf("every channel must receive the event: a=%d b=%d", len(a.got), len(b.got))
+	}
+}
+
+func TestMulti_FiltersKinds(t *testing.T) {
+	t.Parallel()
+
+	a := &fakeNotifier{name: "a"}
+	kinds, err := ParseKinds("finished, failed")
+	if err != nil {
+		t.Fatalf("ParseKinds: %v", err)
+	}
+	m := &Multi{Channels: []Notifier{a}, Kinds: kinds}
+
+	_ = m.Notify(context.Background(), Event{Kind: KindUpToDate})
+	_ = m.Notify(context.Background(), Event{Kind: KindFailed})
+	if len(a.got) != 1 || a.got[0].Kind != KindFailed {
+		t.Fatalf("unexpected events: %+v", a.got)
+	}
+	if a.got[0].Time.IsZero() {
+		t.Fatalf("event time not set")
+	}
+}
+
+func TestParseKinds_Unknown(t *testing.T) {
+	t.Parallel()
+
+	if _, err := ParseKinds("finished,done"); err == nil {
+		t.Fatalf("expected error for unknown kind")
+	}
+}
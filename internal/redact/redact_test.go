@@ -0,0 +1,57 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	t.Parallel()
+
+	Add("hunter2-secret", "abc")
+
+	cases := map[string]string{
+		"dial postgres://loader:p%40ss@db:5432/rfcnpj": "dial postgres://loader:" + Mask + "@db:5432/rfcnpj",
+		"host=db user=loader password=x1y2 dbname=r":   "host=db user=loader password=" + Mask + " dbname=r",
+		"auth failed for hunter2-secret":               "auth failed for " + Mask,
+		"abc is too short to be hidden":                "abc is too short to be hidden",
+		"https://example.test/path":                    "https://example.test/path",
+	}
+	for in, want := range cases {
+		if got := String(in); got != want {
+			t.Fatalf("String(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestError_KeepsChain(t *testing.T) {
+	t.Parallel()
+
+	Add("tok-123456")
+	base := errors.New("send: https://api.test/bottok-123456/sendMessage: timeout")
+	err := Error(base)
+	if strings.Contains(err.Error(), "tok-123456") {
+		t.Fatalf("token not redacted: %v", err)
+	}
+	if !errors.Is(err, base) {
+		t.Fatalf("redacted error should wrap the original")
+	}
+	if Error(nil) != nil {
+		t.Fatalf("nil should stay nil")
+	}
+}
+
+func TestReplaceAttr(t *testing.T) {
+	t.Parallel()
+
+	Add("pw-in-log-9")
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: ReplaceAttr}))
+	log.Error("failed", "error", errors.New("login pw-in-log-9 rejected"), "dsn", "postgres://u:pw-in-log-9@h/db")
+	if strings.Contains(buf.String(), "pw-in-log-9") {
+		t.Fatalf("secret in log: %s", buf.String())
+	}
+}
@@ -0,0 +1,153 @@
+// Package report is the machine-readable summary of one loader run. It is
+// written to disk after every run and can be attached to notifications, so
+// downstream jobs don't have to parse e-mails.
+//
+// The JSON layout is versioned by SchemaVersion: fields may be added within a
+// version, but renaming or removing a field bumps it.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the JSON layout.
+const SchemaVersion = 1
+
+// Run statuses.
+const (
+	StatusLoaded      = "loaded"
+	StatusUpToDate    = "up_to_date"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+type Report struct {
+	SchemaVersion   int       `json:"schema_version"`
+	Status          string    `json:"status"`
+	Month           string    `json:"month,omitempty"`
+	MonthURL        string    `json:"month_url,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+
+	Downloaded int `json:"downloaded"`
+	Extracted  int `json:"extracted"`
+
+	Tables   []Table  `json:"tables"`
+	Files    []File   `json:"files"`
+	Stages   []Stage  `json:"stages"`
+	Warnings []string `json:"warnings,omitempty"`
+	Error    *Error   `json:"error,omitempty"`
+}
+
+type Table struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+	// PreviousRows is the count of the previous load, when known.
+	PreviousRows *int64 `json:"previous_rows,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// File is one remote zip of the month, as listed by PROPFIND.
+type File struct {
+	Name         string `json:"name"`
+	Table        string `json:"table,omitempty"`
+	URL          string `json:"url"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+type Stage struct {
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+type Error struct {
+	Stage   string `json:"stage"`
+	Table   string `json:"table,omitempty"`
+	File    string `json:"file,omitempty"`
+	Message string `json:"message"`
+}
+
+// JSON returns the indented JSON document.
+func (r Report) JSON() ([]byte, error) {
+	r.SchemaVersion = SchemaVersion
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// csvHeader is the layout of WriteCSV: one line per table.
+var csvHeader = []string{"schema_version", "month", "status", "table", "rows", "previous_rows", "delta", "reason"}
+
+// WriteCSV writes the per-table counts as CSV, one line per table.
+func (r Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, t := range r.Tables {
+		prev, delta := "", ""
+		if t.PreviousRows != nil {
+			prev = strconv.FormatInt(*t.PreviousRows, 10)
+			delta = strconv.FormatInt(t.Rows-*t.PreviousRows, 10)
+		}
+		rec := []string{strconv.Itoa(SchemaVersion), r.Month, r.Status, t.Name, strconv.FormatInt(t.Rows, 10), prev, delta, t.Reason}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// CSV returns the output of WriteCSV.
+func (r Report) CSV() ([]byte, error) {
+	var sb strings.Builder
+	if err := r.WriteCSV(&sb); err != nil {
+		return nil, err
+	}
+	return []byte(sb.String()), nil
+}
+
+// LatestFile is the name of the copy of the last report in the directory.
+const LatestFile = "rfcnpj-report-latest.json"
+
+// Write stores the report in dir as rfcnpj-report-<month>-<start>.json and
+// refreshes LatestFile. It returns the path of the dated file.
+func Write(dir string, r Report) (string, error) {
+	b, err := r.JSON()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	month := r.Month
+	if month == "" {
+		month = "unknown"
+	}
+	p := filepath.Join(dir, fmt.Sprintf("rfcnpj-report-%s-%s.json", month, r.StartedAt.UTC().Format("20060102T150405Z")))
+	if err := writeFileAtomic(p, b); err != nil {
+		return "", err
+	}
+	return p, writeFileAtomic(filepath.Join(dir, LatestFile), b)
+}
+
+func writeFileAtomic(p string, b []byte) error {
+	tmp := p + ".part"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
@@ -0,0 +1,100 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleReport() Report {
+	prev := int64(100)
+	start := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	return Report{
+		Status:          StatusLoaded,
+		Month:           "2026-01",
+		MonthURL:        "https://example.test/2026-01/",
+		StartedAt:       start,
+		FinishedAt:      start.Add(time.Hour),
+		DurationSeconds: 3600,
+		Tables: []Table{
+			{Name: "empresa", Rows: 120, PreviousRows: &prev, Reason: "mês novo"},
+			{Name: "moti", Rows: 60},
+		},
+		Files:  []File{{Name: "Empresas0.zip", Table: "empresa", URL: "https://example.test/Empresas0.zip", Size: 10}},
+		Stages: []Stage{{Name: "load", DurationSeconds: 30}},
+	}
+}
+
+func TestReport_JSONIsVersioned(t *testing.T) {
+	t.Parallel()
+
+	b, err := sampleReport().JSON()
+	if err != nil {
+		t.Fatalf("JSON: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got["schema_version"] != float64(SchemaVersion) || got["status"] != "loaded" || got["month"] != "2026-01" {
+		t.Fatalf("unexpected document: %s", b)
+	}
+	tables := got["tables"].([]any)
+	if tables[0].(map[string]any)["previous_rows"] != float64(100) {
+		t.Fatalf("previous_rows missing: %s", b)
+	}
+	if _, ok := tables[1].(map[string]any)["previous_rows"]; ok {
+		t.Fatalf("previous_rows must be omitted when unknown: %s", b)
+	}
+	if _, ok := got["error"]; ok {
+		t.Fatalf("error must be omitted on success: %s", b)
+	}
+}
+
+func TestReport_CSV(t *testing.T) {
+	t.Parallel()
+
+	b, err := sampleReport().CSV()
+	if err != nil {
+		t.Fatalf("CSV: %v", err)
+	}
+	want := "schema_version,month,status,table,rows,previous_rows,delta,reason\n" +
+		"1,2026-01,loaded,empresa,120,100,20,mês novo\n" +
+		"1,2026-01,loaded,moti,60,,,\n"
+	if string(b) != want {
+		t.Fatalf("unexpected csv:\n%s\nwant:\n%s", b, want)
+	}
+}
+
+func TestWrite_DatedAndLatest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	p, err := Write(dir, sampleReport())
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if filepath.Base(p) != "rfcnpj-report-2026-01-20260110T120000Z.json" {
+		t.Fatalf("unexpected path %s", p)
+	}
+	dated, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("read dated: %v", err)
+	}
+	latest, err := os.ReadFile(filepath.Join(dir, LatestFile))
+	if err != nil {
+		t.Fatalf("read latest: %v", err)
+	}
+	if string(dated) != string(latest) {
+		t.Fatalf("latest differs from dated report")
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".part") {
+			t.Fatalf("temp file left behind: %s", e.Name())
+		}
+	}
+}
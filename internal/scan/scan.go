@@ -1,58 +1,163 @@
 package scan
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+
+	"github.com/abriciof/rfcnpj-loader/internal/downloader"
+	"github.com/abriciof/rfcnpj-loader/internal/extract"
 )
 
-type FilesByType struct {
-	Empresa         []string
-	Estabelecimento []string
-	Socios          []string
-	Simples         []string
-	Cnae            []string
-	Moti            []string
-	Munic           []string
-	Natju           []string
-	Pais            []string
-	Quals           []string
+// FilesByType lists the extracted files of each table (loaders.TableSpec
+// name).
+type FilesByType map[string][]string
+
+func (fb *FilesByType) add(table, path string) {
+	if *fb == nil {
+		*fb = FilesByType{}
+	}
+	(*fb)[table] = append((*fb)[table], path)
 }
 
-func ScanExtracted(root string) (FilesByType, error) {
-	var out FilesByType
-	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+// LineageEntry ties an extracted file to the zip it came from and the table it
+// is loaded into. Zip is empty when the file had no extraction manifest and
+// was classified by its name.
+type LineageEntry struct {
+	File  string `json:"file"`
+	Zip   string `json:"zip,omitempty"`
+	Table string `json:"table"`
+	Month string `json:"month"`
+	// Sniff is the content check status (see Verify); empty when not checked.
+	Sniff string `json:"sniff,omitempty"`
+}
+
+type Result struct {
+	Files   FilesByType
+	Lineage []LineageEntry
+	// Unclassified lists files that could not be tied to exactly one table.
+	Unclassified []string
+}
+
+// LineageFile is where WriteLineage stores the lineage inside the extraction
+// directory. It is hidden so the scan itself skips it.
+const LineageFile = ".rfcnpj-lineage.json"
+
+// Scan classifies the files under root (one month of extracted files).
+//
+// Files listed in an extraction manifest get the table of their source zip,
+// using the same rules as downloader.FilterWanted. Files without a manifest
+// (extracted by older versions or by hand) fall back to their name, but only
+// when exactly one name rule matches; anything else is reported in
+// Unclassified instead of being guessed.
+func Scan(root, month string) (Result, error) {
+	manifests, err := extract.ReadManifests(root)
+	if err != nil {
+		return Result{}, err
+	}
+
+	byFile := map[string]LineageEntry{}
+	for _, m := range manifests {
+		table, ok := downloader.TableForZip(m.Zip)
+		if !ok {
+			continue
+		}
+		for _, e := range m.Entries {
+			p := filepath.Join(root, filepath.FromSlash(e.Name))
+			byFile[p] = LineageEntry{File: p, Zip: m.Zip, Table: table, Month: month}
+		}
+	}
+
+	var out Result
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		// arquivos e diretórios ocultos: temporários da extração (.nome.part),
+		// manifestos de extração e afins
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if d.IsDir() {
 			return nil
 		}
-		name := strings.ToUpper(filepath.Base(path))
-
-		switch {
-		case strings.Contains(name, "EMPRE"):
-			out.Empresa = append(out.Empresa, path)
-		case strings.Contains(name, "ESTABELE"):
-			out.Estabelecimento = append(out.Estabelecimento, path)
-		case strings.Contains(name, "SOCIO"):
-			out.Socios = append(out.Socios, path)
-		case strings.Contains(name, "SIMPLES"):
-			out.Simples = append(out.Simples, path)
-		case strings.Contains(name, "CNAE"):
-			out.Cnae = append(out.Cnae, path)
-		case strings.Contains(name, "MOTI") || strings.Contains(name, "MOTIVO"):
-			out.Moti = append(out.Moti, path)
-		case strings.Contains(name, "MUNIC"):
-			out.Munic = append(out.Munic, path)
-		case strings.Contains(name, "NATJU") || strings.Contains(name, "NATURE"):
-			out.Natju = append(out.Natju, path)
-		case strings.Contains(name, "PAIS"):
-			out.Pais = append(out.Pais, path)
-		case strings.Contains(name, "QUAL"):
-			out.Quals = append(out.Quals, path)
+
+		entry, ok := byFile[path]
+		if !ok {
+			table, found := classifyByName(filepath.Base(path))
+			if !found {
+				out.Unclassified = append(out.Unclassified, path)
+				return nil
+			}
+			entry = LineageEntry{File: path, Table: table, Month: month}
 		}
+		out.Files.add(entry.Table, path)
+		out.Lineage = append(out.Lineage, entry)
 		return nil
 	})
 	return out, err
 }
+
+// ScanExtracted groups the files under root by table. See Scan.
+func ScanExtracted(root string) (FilesByType, error) {
+	res, err := Scan(root, "")
+	return res.Files, err
+}
+
+var nameRules = []struct {
+	table   string
+	needles []string
+}{
+	{"empresa", []string{"EMPRE"}},
+	{"estabelecimento", []string{"ESTABELE"}},
+	{"socios", []string{"SOCIO"}},
+	{"simples", []string{"SIMPLES"}},
+	{"cnae", []string{"CNAE"}},
+	{"moti", []string{"MOTI"}},
+	{"munic", []string{"MUNIC"}},
+	{"natju", []string{"NATJU", "NATURE"}},
+	{"pais", []string{"PAIS"}},
+	{"quals", []string{"QUAL"}},
+}
+
+// classifyByName returns the table whose name rule matches base, if exactly
+// one does.
+func classifyByName(base string) (string, bool) {
+	name := strings.ToUpper(base)
+	var matches []string
+	for _, r := range nameRules {
+		for _, n := range r.needles {
+			if strings.Contains(name, n) {
+				matches = append(matches, r.table)
+				break
+			}
+		}
+	}
+	if len(matches) != 1 {
+		return "", false
+	}
+	return matches[0], true
+}
+
+// WriteLineage stores the lineage as JSON in root/LineageFile.
+func WriteLineage(root string, lineage []LineageEntry) error {
+	sorted := make([]LineageEntry, len(lineage))
+	copy(sorted, lineage)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].File < sorted[j].File })
+
+	b, err := json.MarshalIndent(sorted, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(root, LineageFile)
+	tmp := p + ".part"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
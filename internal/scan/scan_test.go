@@ -1,9 +1,13 @@
 package scan
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/abriciof/rfcnpj-loader/internal/davtest"
+	"github.com/abriciof/rfcnpj-loader/internal/extract"
 )
 
 func TestScanExtracted_GroupsFilesByType(t *testing.T) {
@@ -22,7 +26,13 @@ func TestScanExtracted_GroupsFilesByType(t *testing.T) {
 		"PAISES.txt",
 		"QUALIFICACOES.txt",
 		"IGNORAR.txt",
+		".EMPRECSV.part",
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, ".rfcnpj-extract"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
 	}
+	files = append(files, ".rfcnpj-extract/Simples.zip.json")
 
 	for _, name := range files {
 		p := filepath.Join(root, name)
@@ -36,17 +46,82 @@ func TestScanExtracted_GroupsFilesByType(t *testing.T) {
 		t.Fatalf("ScanExtracted returned error: %v", err)
 	}
 
-	if len(got.Empresa) != 1 ||
-		len(got.Estabelecimento) != 1 ||
-		len(got.Socios) != 1 ||
-		len(got.Simples) != 1 ||
-		len(got.Cnae) != 1 ||
-		len(got.Moti) != 1 ||
-		len(got.Munic) != 1 ||
-		len(got.Natju) != 1 ||
-		len(got.Pais) != 1 ||
-		len(got.Quals) != 1 {
+	if len(got["empresa"]) != 1 ||
+		len(got["estabelecimento"]) != 1 ||
+		len(got["socios"]) != 1 ||
+		len(got["simples"]) != 1 ||
+		len(got["cnae"]) != 1 ||
+		len(got["moti"]) != 1 ||
+		len(got["munic"]) != 1 ||
+		len(got["natju"]) != 1 ||
+		len(got["pais"]) != 1 ||
+		len(got["quals"]) != 1 {
 		t.Fatalf("unexpected grouping counts: %+v", got)
 	}
 }
 
+
+func TestScan_UsesExtractionLineage(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "2026-01")
+
+	// both names would be ambiguous or wrong for the name heuristic
+	zips := map[string]map[string]string{
+		"Simples.zip": {"F.K03200$W.QUALSIMPLES.CSV": "x"},
+		"Motivos.zip": {"F.K03200$Z.D60110.CSV": "x"},
+	}
+	var zipPaths []string
+	for name, entries := range zips {
+		p := filepath.Join(dir, name)
+		if err := davtest.WriteZip(p, entries); err != nil {
+			t.Fatalf("write zip: %v", err)
+		}
+		zipPaths = append(zipPaths, p)
+	}
+	if err := extract.NewExtractor(1, true).ExtractAll(context.Background(), zipPaths, root); err != nil {
+		t.Fatalf("ExtractAll returned error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "README"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write stray file: %v", err)
+	}
+
+	got, err := Scan(root, "2026-01")
+	if err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	if len(got.Files["simples"]) != 1 || len(got.Files["quals"]) != 0 || len(got.Files["moti"]) != 1 {
+		t.Fatalf("unexpected grouping: %+v", got.Files)
+	}
+	if len(got.Unclassified) != 1 || filepath.Base(got.Unclassified[0]) != "README" {
+		t.Fatalf("expected README to be unclassified, got %v", got.Unclassified)
+	}
+	for _, l := range got.Lineage {
+		if l.Zip == "" || l.Month != "2026-01" {
+			t.Fatalf("expected lineage from manifest, got %+v", l)
+		}
+	}
+
+	if err := WriteLineage(root, got.Lineage); err != nil {
+		t.Fatalf("WriteLineage returned error: %v", err)
+	}
+	again, err := Scan(root, "2026-01")
+	if err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	if len(again.Lineage) != len(got.Lineage) {
+		t.Fatal("lineage file must not be picked up by the scan")
+	}
+}
+
+func TestClassifyByName_Ambiguous(t *testing.T) {
+	t.Parallel()
+
+	if _, ok := classifyByName("SIMPLES_QUAL.csv"); ok {
+		t.Fatal("expected ambiguous name to be unclassified")
+	}
+	if got, ok := classifyByName("K3241.K03200Y0.D40113.EMPRECSV"); !ok || got != "empresa" {
+		t.Fatalf("unexpected classification: %q %v", got, ok)
+	}
+}
@@ -0,0 +1,234 @@
+package scan
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+
+	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+)
+
+const (
+	// sniffRecords is how many records are read from the start of each file.
+	sniffRecords = 50
+	// sniffMinMatch is the share of sampled records that must fit a layout.
+	sniffMinMatch = 0.9
+)
+
+// Detection statuses.
+const (
+	SniffConfirmed = "confirmed" // content matches the table chosen by lineage/name
+	SniffCorrected = "corrected" // content matches exactly one other table
+	SniffMismatch  = "mismatch"  // content matches none or several other tables
+	SniffEmpty     = "empty"     // no records to look at; the chosen table is kept
+)
+
+// Detection is the result of sniffing one file.
+type Detection struct {
+	File   string
+	Chosen string // table chosen by lineage or name
+	Table  string // table after sniffing (empty on mismatch)
+	Status string
+	// Fields is the most common field count in the sample.
+	Fields int
+	// Compatible lists every table whose layout fits the sample.
+	Compatible []string
+}
+
+func (d Detection) String() string {
+	switch d.Status {
+	case SniffCorrected:
+		return fmt.Sprintf("%s: conteúdo é de %s, não de %s (%d colunas)", d.File, d.Table, d.Chosen, d.Fields)
+	case SniffMismatch:
+		if len(d.Compatible) == 0 {
+			return fmt.Sprintf("%s: conteúdo (%d colunas) não corresponde a %s nem a nenhuma tabela conhecida", d.File, d.Fields, d.Chosen)
+		}
+		return fmt.Sprintf("%s: conteúdo (%d colunas) não corresponde a %s; compatível com %s", d.File, d.Fields, d.Chosen, strings.Join(d.Compatible, ", "))
+	}
+	return fmt.Sprintf("%s: %s (%s)", d.File, d.Chosen, d.Status)
+}
+
+type compiledSpec struct {
+	name     string
+	cols     int
+	patterns map[int]*regexp.Regexp
+}
+
+func compileSpecs(specs []loaders.TableSpec) ([]compiledSpec, error) {
+	out := make([]compiledSpec, 0, len(specs))
+	for _, s := range specs {
+		cs := compiledSpec{name: s.Name, cols: len(s.Columns), patterns: map[int]*regexp.Regexp{}}
+		for i, col := range s.Columns {
+			pat, ok := s.Patterns[col]
+			if !ok {
+				continue
+			}
+			re, err := regexp.Compile(pat)
+			if err != nil {
+				return nil, fmt.Errorf("padrão inválido para %s.%s: %w", s.Name, col, err)
+			}
+			cs.patterns[i] = re
+		}
+		out = append(out, cs)
+	}
+	return out, nil
+}
+
+func (cs compiledSpec) fits(rec []string) bool {
+	if len(rec) != cs.cols {
+		return false
+	}
+	for i, re := range cs.patterns {
+		if !re.MatchString(strings.TrimSpace(rec[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// sample reads up to n records from the start of a ';' separated latin-1 file,
+// the same way loaders.CopyCSV reads it.
+func sample(path string, n int) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(transform.NewReader(f, charmap.ISO8859_1.NewDecoder()))
+	reader.Comma = ';'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var out [][]string
+	for len(out) < n {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return out, fmt.Errorf("sniff %s: %w", path, err)
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// SniffFile checks the first records of path against every spec and decides
+// whether the chosen table is right.
+func SniffFile(path, chosen string, specs []loaders.TableSpec) (Detection, error) {
+	compiled, err := compileSpecs(specs)
+	if err != nil {
+		return Detection{}, err
+	}
+	return sniffFile(path, chosen, compiled)
+}
+
+func sniffFile(path, chosen string, specs []compiledSpec) (Detection, error) {
+	d := Detection{File: path, Chosen: chosen}
+	records, err := sample(path, sniffRecords)
+	if err != nil {
+		return d, err
+	}
+	if len(records) == 0 {
+		d.Table, d.Status = chosen, SniffEmpty
+		return d, nil
+	}
+
+	counts := map[int]int{}
+	for _, rec := range records {
+		counts[len(rec)]++
+	}
+	for fields, c := range counts {
+		if c > counts[d.Fields] || (c == counts[d.Fields] && fields < d.Fields) {
+			d.Fields = fields
+		}
+	}
+
+	chosenFits := false
+	for _, cs := range specs {
+		matched := 0
+		for _, rec := range records {
+			if cs.fits(rec) {
+				matched++
+			}
+		}
+		if float64(matched) >= sniffMinMatch*float64(len(records)) {
+			d.Compatible = append(d.Compatible, cs.name)
+			if cs.name == chosen {
+				chosenFits = true
+			}
+		}
+	}
+
+	switch {
+	case chosenFits:
+		d.Table, d.Status = chosen, SniffConfirmed
+	case len(d.Compatible) == 1:
+		d.Table, d.Status = d.Compatible[0], SniffCorrected
+	default:
+		d.Status = SniffMismatch
+	}
+	return d, nil
+}
+
+// Verify sniffs every classified file and applies to res the corrections
+// that involve tables (the ones being loaded): a file of one of tables moves
+// to the detected table when that is also one of tables, and is removed from
+// its table otherwise (mismatch), so it is never dropped from the load
+// silently; a file of another table is pulled into one of tables when its
+// content is of that table. It returns the detections that were not plain
+// confirmations, so the caller can report them before anything is loaded.
+//
+// Tables with the same layout (see loaders.TableSpec.Patterns) can't be told
+// apart: a file of one classified as the other is confirmed.
+func Verify(res *Result, specs []loaders.TableSpec, tables map[string]bool) ([]Detection, error) {
+	compiled, err := compileSpecs(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out   []Detection
+		files FilesByType
+	)
+	for i, l := range res.Lineage {
+		d, err := sniffFile(l.File, l.Table, compiled)
+		if err != nil {
+			return nil, err
+		}
+		if !tables[l.Table] {
+			// fora da carga: só interessa se o conteúdo for de uma tabela carregada
+			if d.Status == SniffCorrected && tables[d.Table] {
+				out = append(out, d)
+				res.Lineage[i].Sniff, res.Lineage[i].Table = d.Status, d.Table
+				files.add(d.Table, l.File)
+				continue
+			}
+			files.add(l.Table, l.File)
+			continue
+		}
+		if d.Status == SniffCorrected && !tables[d.Table] {
+			// movê-lo tiraria o arquivo da carga sem erro nenhum
+			d.Table, d.Status = "", SniffMismatch
+		}
+		if d.Status != SniffConfirmed {
+			out = append(out, d)
+		}
+		res.Lineage[i].Sniff = d.Status
+		if d.Table == "" {
+			res.Lineage[i].Table = ""
+			continue
+		}
+		res.Lineage[i].Table = d.Table
+		files.add(d.Table, l.File)
+	}
+	res.Files = files
+	return out, nil
+}
@@ -0,0 +1,135 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+)
+
+const (
+	sampleEmpresa = `"12345678";"EMPRESA TESTE LTDA";"2062";"49";"1000,00";"01";""` + "\n"
+	sampleSimples = `"12345678";"S";"20200101";"00000000";"N";"00000000";"00000000"` + "\n"
+	sampleEstab   = `"12345678";"0001";"90";"1";"";"02";"20050101";"00";"";"";"20050101";"4751201";"";"RUA";"X";"1";"";"CENTRO";"69000000";"AM";"0255";"92";"12345678";"";"";"";"";"";"";""` + "\n"
+	sampleCnae    = `"0111301";"Cultivo de arroz"` + "\n"
+	sampleNatju   = `"2062";"Sociedade Empresária Limitada"` + "\n"
+)
+
+func TestSniffFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cases := []struct {
+		name, content, chosen, wantTable, wantStatus string
+	}{
+		{"empresa", sampleEmpresa, "empresa", "empresa", SniffConfirmed},
+		{"simples-as-empresa", sampleSimples, "empresa", "simples", SniffCorrected},
+		{"estab-as-socios", sampleEstab, "socios", "estabelecimento", SniffCorrected},
+		{"cnae", sampleCnae, "cnae", "cnae", SniffConfirmed},
+		// natju and munic share the layout: the chosen table is kept
+		{"natju-as-munic", sampleNatju, "munic", "munic", SniffConfirmed},
+		// a lookup file can't be corrected to a single table
+		{"natju-as-empresa", sampleNatju, "empresa", "", SniffMismatch},
+		{"empty", "", "pais", "pais", SniffEmpty},
+	}
+	for _, tc := range cases {
+		p := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(p, []byte(tc.content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", p, err)
+		}
+		d, err := SniffFile(p, tc.chosen, loaders.All)
+		if err != nil {
+			t.Fatalf("%s: SniffFile returned error: %v", tc.name, err)
+		}
+		if d.Table != tc.wantTable || d.Status != tc.wantStatus {
+			t.Fatalf("%s: got table=%q status=%q (compatible %v), want table=%q status=%q",
+				tc.name, d.Table, d.Status, d.Compatible, tc.wantTable, tc.wantStatus)
+		}
+	}
+}
+
+func TestVerify_AppliesCorrections(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(root, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", p, err)
+		}
+		return p
+	}
+	emp := write("K3241.K03200Y0.D40113.EMPRECSV", sampleSimples)
+	natju := write("F.K03200$Z.D40113.EMPRE2CSV", sampleNatju)
+	cnae := write("F.K03200$Z.D40113.CNAECSV", sampleCnae)
+
+	res, err := Scan(root, "2024-01")
+	if err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	detections, err := Verify(&res, loaders.All, map[string]bool{"empresa": true, "simples": true})
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+
+	if len(detections) != 2 {
+		t.Fatalf("expected 2 detections, got %+v", detections)
+	}
+	if len(res.Files["empresa"]) != 0 {
+		t.Fatalf("expected no empresa files after verify, got %v", res.Files["empresa"])
+	}
+	if len(res.Files["simples"]) != 1 || res.Files["simples"][0] != emp {
+		t.Fatalf("expected %s to move to simples, got %v", emp, res.Files["simples"])
+	}
+	if len(res.Files["cnae"]) != 1 || res.Files["cnae"][0] != cnae {
+		t.Fatalf("tables outside the check must keep their files, got %v", res.Files["cnae"])
+	}
+	for _, d := range detections {
+		if d.File == natju && (d.Status != SniffMismatch || !strings.Contains(d.String(), "natju")) {
+			t.Fatalf("unexpected detection for natju file: %+v (%s)", d, d)
+		}
+	}
+}
+
+func TestVerify_CorrectionsAcrossTheLoad(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(root, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", p, err)
+		}
+		return p
+	}
+	// conteúdo de simples num arquivo de empresa, e de cnae num de pais
+	emp := write("K3241.K03200Y0.D40113.EMPRECSV", sampleSimples)
+	pais := write("F.K03200$Z.D40113.PAISCSV", sampleCnae)
+
+	res, err := Scan(root, "2024-01")
+	if err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	detections, err := Verify(&res, loaders.All, map[string]bool{"empresa": true, "cnae": true})
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+
+	// simples não está na carga: o arquivo não sai dela em silêncio
+	if len(res.Files["empresa"]) != 0 || len(res.Files["simples"]) != 0 {
+		t.Fatalf("file of a table outside the load must not move there, got %v", res.Files)
+	}
+	// o arquivo de pais (fora da carga) com conteúdo de cnae entra nela
+	if len(res.Files["cnae"]) != 1 || res.Files["cnae"][0] != pais || len(res.Files["pais"]) != 0 {
+		t.Fatalf("expected %s pulled into cnae, got %v", pais, res.Files)
+	}
+	got := map[string]string{}
+	for _, d := range detections {
+		got[d.File] = d.Status
+	}
+	if got[emp] != SniffMismatch || got[pais] != SniffCorrected || len(got) != 2 {
+		t.Fatalf("unexpected detections: %+v", detections)
+	}
+}
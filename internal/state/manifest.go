@@ -0,0 +1,84 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/abriciof/rfcnpj-loader/internal/dav"
+)
+
+// ManifestEntry is what the remote share told us about one source zip.
+type ManifestEntry struct {
+	Name         string `json:"name"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"last_modified"`
+}
+
+// Manifest lists the source zips a table was loaded from, sorted by name.
+type Manifest []ManifestEntry
+
+func NewManifest(items []dav.Item) Manifest {
+	m := make(Manifest, 0, len(items))
+	for _, it := range items {
+		m = append(m, ManifestEntry{
+			Name:         path.Base(it.Href),
+			Size:         it.ContentLength,
+			LastModified: it.LastModified,
+		})
+	}
+	sort.Slice(m, func(i, j int) bool { return m[i].Name < m[j].Name })
+	return m
+}
+
+func ParseManifest(s string) (Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, fmt.Errorf("manifest inválido: %w", err)
+	}
+	return m, nil
+}
+
+func (m Manifest) Encode() string {
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// Hash identifies the manifest: the sha256 (hex) of its encoding.
+func (m Manifest) Hash() string {
+	sum := sha256.Sum256([]byte(m.Encode()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Changes describes how current differs from m (the stored manifest).
+// An empty result means the files were not republished.
+func (m Manifest) Changes(current Manifest) []string {
+	old := make(map[string]ManifestEntry, len(m))
+	for _, e := range m {
+		old[e.Name] = e
+	}
+
+	var out []string
+	seen := make(map[string]bool, len(current))
+	for _, e := range current {
+		seen[e.Name] = true
+		prev, ok := old[e.Name]
+		switch {
+		case !ok:
+			out = append(out, fmt.Sprintf("%s: novo arquivo", e.Name))
+		case prev.Size != e.Size:
+			out = append(out, fmt.Sprintf("%s: tamanho %d -> %d", e.Name, prev.Size, e.Size))
+		case prev.LastModified != e.LastModified:
+			out = append(out, fmt.Sprintf("%s: modificado %s -> %s", e.Name, prev.LastModified, e.LastModified))
+		}
+	}
+	for _, e := range m {
+		if !seen[e.Name] {
+			out = append(out, fmt.Sprintf("%s: removido", e.Name))
+		}
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package state
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abriciof/rfcnpj-loader/internal/dav"
+)
+
+func TestManifest_EncodeParseRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	m := NewManifest([]dav.Item{
+		{Href: "/x/2026-01/Socios1.zip", ContentLength: 20, LastModified: "Tue, 13 Jan 2026 10:00:00 GMT"},
+		{Href: "/x/2026-01/Socios0.zip", ContentLength: 10, LastModified: "Tue, 13 Jan 2026 10:00:00 GMT"},
+	})
+	if m[0].Name != "Socios0.zip" {
+		t.Fatalf("expected manifest sorted by name, got %+v", m)
+	}
+
+	got, err := ParseManifest(m.Encode())
+	if err != nil {
+		t.Fatalf("ParseManifest returned error: %v", err)
+	}
+	if len(got.Changes(m)) != 0 {
+		t.Fatalf("expected no changes after round trip, got %v", got.Changes(m))
+	}
+}
+
+func TestManifest_Changes(t *testing.T) {
+	t.Parallel()
+
+	stored := Manifest{
+		{Name: "A.zip", Size: 1, LastModified: "d1"},
+		{Name: "B.zip", Size: 2, LastModified: "d1"},
+		{Name: "C.zip", Size: 3, LastModified: "d1"},
+	}
+	current := Manifest{
+		{Name: "A.zip", Size: 1, LastModified: "d1"},
+		{Name: "B.zip", Size: 5, LastModified: "d2"},
+		{Name: "D.zip", Size: 4, LastModified: "d2"},
+	}
+
+	changes := stored.Changes(current)
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %v", changes)
+	}
+	joined := strings.Join(changes, "\n")
+	for _, want := range []string{"B.zip: tamanho 2 -> 5", "D.zip: novo arquivo", "C.zip: removido"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing %q in %v", want, changes)
+		}
+	}
+}
+
+func TestManifest_Hash(t *testing.T) {
+	t.Parallel()
+
+	a := Manifest{{Name: "A.zip", Size: 1, LastModified: "d1"}}
+	b := Manifest{{Name: "A.zip", Size: 2, LastModified: "d1"}}
+	if len(a.Hash()) != 64 || a.Hash() != a.Hash() {
+		t.Fatalf("unexpected hash %q", a.Hash())
+	}
+	if a.Hash() == b.Hash() {
+		t.Fatalf("different manifests must hash differently")
+	}
+}
@@ -3,27 +3,171 @@ package state
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+	"github.com/abriciof/rfcnpj-loader/internal/timeutil"
 )
 
+// querier is what MetaStore and MetaTx need from *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// MetaStore reads and writes rfcnpj_meta (created by internal/migrate).
 type MetaStore struct {
-	db *sql.DB
+	db    *sql.DB
+	table string
+	names names
 }
 
-func NewMetaStore(db *sql.DB) *MetaStore { return &MetaStore{db: db} }
+// NewMetaStore uses the rfcnpj_meta of schema (TARGET_SCHEMA), or the one the
+// search_path finds when schema is empty.
+func NewMetaStore(db *sql.DB, schema string) *MetaStore {
+	return &MetaStore{db: db, table: loaders.QualifiedIdent(schema, "rfcnpj_meta")}
+}
 
-func (m *MetaStore) Ensure(ctx context.Context) error {
-	_, err := m.db.ExecContext(ctx, `
-CREATE TABLE IF NOT EXISTS rfcnpj_meta (
-  key text PRIMARY KEY,
-  value text NOT NULL,
-  updated_at timestamptz NOT NULL DEFAULT now()
-);`)
-	return err
+// WithTableNames makes the keys of m follow TABLE_PREFIX and TABLE_SUFFIX, so
+// loaders that share rfcnpj_meta (same schema) keep separate state: per-table
+// keys use the table name in the database and the others get "@<prefix>*<suffix>".
+func (m *MetaStore) WithTableNames(prefix, suffix string) *MetaStore {
+	m.names = names{prefix: prefix, suffix: suffix}
+	return m
+}
+
+type names struct{ prefix, suffix string }
+
+func (n names) table(prefix, table string) string {
+	return tableKey(prefix, n.prefix+table+n.suffix)
+}
+
+func (n names) global(key string) string {
+	if n.prefix == "" && n.suffix == "" {
+		return key
+	}
+	return key + "@" + n.prefix + "*" + n.suffix
 }
 
 func (m *MetaStore) Get(ctx context.Context, key string) (string, bool, error) {
+	return getMeta(ctx, m.db, m.table, key)
+}
+
+func (m *MetaStore) Set(ctx context.Context, key, value string) error {
+	return setMeta(ctx, m.db, m.table, key, value)
+}
+
+// LoadedMonth is the month table was last loaded from.
+func (m *MetaStore) LoadedMonth(ctx context.Context, table string) (timeutil.YearMonth, bool, error) {
+	v, ok, err := m.Get(ctx, m.names.table("loaded_month_", table))
+	if err != nil || !ok {
+		return timeutil.YearMonth{}, false, err
+	}
+	ym, err := timeutil.ParseYearMonth(v)
+	if err != nil {
+		return timeutil.YearMonth{}, false, fmt.Errorf("meta inválida para %s: %w", table, err)
+	}
+	return ym, true, nil
+}
+
+// LoadedManifest is the manifest of the zips table was last loaded from. It
+// is absent for tables loaded by versions that didn't store it.
+func (m *MetaStore) LoadedManifest(ctx context.Context, table string) (Manifest, bool, error) {
+	v, ok, err := m.Get(ctx, m.names.table("loaded_manifest_", table))
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	man, err := ParseManifest(v)
+	if err != nil {
+		return nil, false, fmt.Errorf("meta inválida para %s: %w", table, err)
+	}
+	return man, true, nil
+}
+
+// LoadedRows is the row count of the last load of table.
+func (m *MetaStore) LoadedRows(ctx context.Context, table string) (int64, bool, error) {
+	v, ok, err := m.Get(ctx, m.names.table("loaded_rows_", table))
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("meta inválida para %s: %w", table, err)
+	}
+	return n, true, nil
+}
+
+// Update runs fn in a transaction; it commits when fn returns nil and rolls
+// back otherwise. Statements run through MetaTx.Tx are part of it, so data
+// changes and the meta that describes them are applied together.
+func (m *MetaStore) Update(ctx context.Context, fn func(*MetaTx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&MetaTx{Tx: tx, table: m.table, names: m.names}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// MetaTx writes rfcnpj_meta inside a transaction started by MetaStore.Update.
+type MetaTx struct {
+	Tx    *sql.Tx
+	table string
+	names names
+}
+
+func (t *MetaTx) Set(ctx context.Context, key, value string) error {
+	return setMeta(ctx, t.Tx, t.table, key, value)
+}
+
+// SetLoaded records the month of the last successful run (loaded_month,
+// loaded_url).
+func (t *MetaTx) SetLoaded(ctx context.Context, month timeutil.YearMonth, url string) error {
+	if err := t.Set(ctx, t.names.global("loaded_month"), month.String()); err != nil {
+		return err
+	}
+	return t.Set(ctx, t.names.global("loaded_url"), url)
+}
+
+// TableLoad is what is recorded about the last load of a table.
+type TableLoad struct {
+	Month    timeutil.YearMonth
+	URL      string
+	Manifest Manifest
+	Reason   string
+	Rows     int64
+	// RunID is the rfcnpj_runs row of the load; 0 when it wasn't recorded.
+	RunID int64
+}
+
+func (t *MetaTx) SetTableLoad(ctx context.Context, table string, l TableLoad) error {
+	kv := [][2]string{
+		{"loaded_month_", l.Month.String()},
+		{"loaded_url_", l.URL},
+		{"loaded_manifest_", l.Manifest.Encode()},
+		{"loaded_manifest_hash_", l.Manifest.Hash()},
+		{"loaded_reason_", l.Reason},
+		{"loaded_rows_", strconv.FormatInt(l.Rows, 10)},
+		{"loaded_run_", strconv.FormatInt(l.RunID, 10)},
+	}
+	for _, e := range kv {
+		if err := t.Set(ctx, t.names.table(e[0], table), e[1]); err != nil {
+			return fmt.Errorf("gravar meta %s%s: %w", e[0], table, err)
+		}
+	}
+	return nil
+}
+
+func tableKey(prefix, table string) string { return prefix + strings.ToLower(table) }
+
+func getMeta(ctx context.Context, q querier, table, key string) (string, bool, error) {
 	var v string
-	err := m.db.QueryRowContext(ctx, `SELECT value FROM rfcnpj_meta WHERE key=$1`, key).Scan(&v)
+	err := q.QueryRowContext(ctx, `SELECT value FROM `+table+` WHERE key=$1`, key).Scan(&v)
 	if err == sql.ErrNoRows {
 		return "", false, nil
 	}
@@ -33,9 +177,9 @@ func (m *MetaStore) Get(ctx context.Context, key string) (string, bool, error) {
 	return v, true, nil
 }
 
-func (m *MetaStore) Set(ctx context.Context, key, value string) error {
-	_, err := m.db.ExecContext(ctx, `
-INSERT INTO rfcnpj_meta(key,value) VALUES ($1,$2)
+func setMeta(ctx context.Context, q querier, table, key, value string) error {
+	_, err := q.ExecContext(ctx, `
+INSERT INTO `+table+`(key,value) VALUES ($1,$2)
 ON CONFLICT (key) DO UPDATE SET value=excluded.value, updated_at=now()
 `, key, value)
 	return err
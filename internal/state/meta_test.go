@@ -0,0 +1,38 @@
+package state
+
+import "testing"
+
+func TestNames_Keys(t *testing.T) {
+	t.Parallel()
+
+	var plain names
+	if got := plain.table("loaded_month_", "Empresa"); got != "loaded_month_empresa" {
+		t.Fatalf("unexpected key %q", got)
+	}
+	if got := plain.global("loaded_month"); got != "loaded_month" {
+		t.Fatalf("unexpected key %q", got)
+	}
+
+	n := names{prefix: "stg_", suffix: "_v2"}
+	if got := n.table("loaded_rows_", "socios"); got != "loaded_rows_stg_socios_v2" {
+		t.Fatalf("unexpected key %q", got)
+	}
+	if got := n.global("loaded_url"); got != "loaded_url@stg_*_v2" {
+		t.Fatalf("unexpected key %q", got)
+	}
+}
+
+func TestStores_QualifyTablesWithSchema(t *testing.T) {
+	t.Parallel()
+
+	if got := NewMetaStore(nil, "").table; got != `"rfcnpj_meta"` {
+		t.Fatalf("unexpected table %q", got)
+	}
+	if got := NewMetaStore(nil, "staging").table; got != `"staging"."rfcnpj_meta"` {
+		t.Fatalf("unexpected table %q", got)
+	}
+	runs := NewRunStore(nil, "staging")
+	if runs.runs != `"staging"."rfcnpj_runs"` || runs.stages != `"staging"."rfcnpj_run_stages"` {
+		t.Fatalf("unexpected tables %q, %q", runs.runs, runs.stages)
+	}
+}
@@ -0,0 +1,92 @@
+package state
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/abriciof/rfcnpj-loader/internal/loaders"
+)
+
+// StatusRunning marks a run or stage that has not ended; a run then takes
+// the status of the run report (internal/report) and a stage ends as
+// StageDone or StageFailed.
+const (
+	StatusRunning = "running"
+	StageDone     = "done"
+	StageFailed   = "failed"
+)
+
+// RunStore keeps the history of executions: one row per run in rfcnpj_runs
+// and one row per stage in rfcnpj_run_stages (created by internal/migrate).
+type RunStore struct {
+	db           *sql.DB
+	runs, stages string
+}
+
+// NewRunStore uses the tables of schema (TARGET_SCHEMA), or the ones the
+// search_path finds when schema is empty.
+func NewRunStore(db *sql.DB, schema string) *RunStore {
+	return &RunStore{
+		db:     db,
+		runs:   loaders.QualifiedIdent(schema, "rfcnpj_runs"),
+		stages: loaders.QualifiedIdent(schema, "rfcnpj_run_stages"),
+	}
+}
+
+// Start inserts a running run and returns its id.
+func (s *RunStore) Start(ctx context.Context, trigger string, startedAt time.Time) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `
+INSERT INTO `+s.runs+`(trigger, status, started_at) VALUES ($1,$2,$3) RETURNING id
+`, trigger, StatusRunning, startedAt).Scan(&id)
+	return id, err
+}
+
+func (s *RunStore) SetMonth(ctx context.Context, id int64, month string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE `+s.runs+` SET month=$2 WHERE id=$1`, id, month)
+	return err
+}
+
+// BeginStage records stage as running. Running it again for the same stage
+// restarts it.
+func (s *RunStore) BeginStage(ctx context.Context, id int64, stage string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO `+s.stages+`(run_id, stage, status, started_at) VALUES ($1,$2,$3,$4)
+ON CONFLICT (run_id, stage) DO UPDATE SET status=excluded.status, started_at=excluded.started_at, finished_at=NULL, error=''
+`, id, stage, StatusRunning, at)
+	return err
+}
+
+// EndStage closes stage with status StageDone or StageFailed.
+func (s *RunStore) EndStage(ctx context.Context, id int64, stage, status string, at time.Time, errText string) error {
+	_, err := s.db.ExecContext(ctx, `
+UPDATE `+s.stages+` SET status=$3, finished_at=$4, error=$5 WHERE run_id=$1 AND stage=$2
+`, id, stage, status, at, errText)
+	return err
+}
+
+// RunResult is what Finish stores about a run that ended.
+type RunResult struct {
+	Status          string
+	FinishedAt      time.Time
+	BytesDownloaded int64
+	TableRows       map[string]int64
+	Error           string
+}
+
+func (s *RunStore) Finish(ctx context.Context, id int64, r RunResult) error {
+	rows := r.TableRows
+	if rows == nil {
+		rows = map[string]int64{}
+	}
+	b, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+UPDATE `+s.runs+` SET status=$2, finished_at=$3, bytes_downloaded=$4, table_rows=$5, error=$6 WHERE id=$1
+`, id, r.Status, r.FinishedAt, r.BytesDownloaded, string(b), r.Error)
+	return err
+}
@@ -0,0 +1,127 @@
+// Package templates renders notification subjects and bodies. Defaults for
+// each locale are embedded; any of them can be replaced by a file with the
+// same name in an override directory.
+//
+// Each kind has a text file "<kind>.txt" (text/template) that defines the
+// "subject" and "text" templates, and optionally "<kind>.html"
+// (html/template) for clients that show HTML.
+package templates
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/abriciof/rfcnpj-loader/internal/timeutil"
+)
+
+//go:embed pt-BR en
+var embedded embed.FS
+
+// Kinds rendered by a Set; they match the notification events.
+var Kinds = []string{"started", "up_to_date", "finished", "failed"}
+
+type Set struct {
+	Locale string
+	text   map[string]*texttemplate.Template
+	html   map[string]*htmltemplate.Template
+}
+
+// Load parses the templates of locale, replacing embedded files by the ones
+// found in overrideDir (if not empty).
+func Load(locale, overrideDir string) (*Set, error) {
+	l, ok := timeutil.NormalizeLocale(locale)
+	if !ok {
+		return nil, fmt.Errorf("locale não suportado: %q (use pt-BR ou en)", locale)
+	}
+	s := &Set{
+		Locale: l,
+		text:   map[string]*texttemplate.Template{},
+		html:   map[string]*htmltemplate.Template{},
+	}
+	for _, kind := range Kinds {
+		src, name, err := read(l, overrideDir, kind+".txt")
+		if err != nil {
+			return nil, err
+		}
+		t, err := texttemplate.New(name).Option("missingkey=error").Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+		for _, def := range []string{"subject", "text"} {
+			if t.Lookup(def) == nil {
+				return nil, fmt.Errorf("template %s: falta o bloco %q", name, def)
+			}
+		}
+		s.text[kind] = t
+
+		src, name, err = read(l, overrideDir, kind+".html")
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		h, err := htmltemplate.New(name).Option("missingkey=error").Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+		s.html[kind] = h
+	}
+	return s, nil
+}
+
+// read returns the override file when there is one, else the embedded one.
+func read(locale, overrideDir, file string) (string, string, error) {
+	if overrideDir != "" {
+		p := filepath.Join(overrideDir, file)
+		b, err := os.ReadFile(p)
+		if err == nil {
+			return string(b), p, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", p, err
+		}
+	}
+	p := locale + "/" + file
+	b, err := embedded.ReadFile(p)
+	return string(b), p, err
+}
+
+// Subject renders the subject of kind, on a single line.
+func (s *Set) Subject(kind string, data any) (string, error) {
+	out, err := s.exec(kind, "subject", data)
+	return strings.Join(strings.Fields(out), " "), err
+}
+
+// Text renders the plain-text body of kind.
+func (s *Set) Text(kind string, data any) (string, error) {
+	return s.exec(kind, "text", data)
+}
+
+// HTML renders the HTML body of kind; ok is false when kind has none.
+func (s *Set) HTML(kind string, data any) (out string, ok bool, err error) {
+	t, ok := s.html[kind]
+	if !ok {
+		return "", false, nil
+	}
+	var sb strings.Builder
+	err = t.Execute(&sb, data)
+	return sb.String(), true, err
+}
+
+func (s *Set) exec(kind, def string, data any) (string, error) {
+	t, ok := s.text[kind]
+	if !ok {
+		return "", fmt.Errorf("template desconhecido: %s", kind)
+	}
+	var sb strings.Builder
+	err := t.ExecuteTemplate(&sb, def, data)
+	return sb.String(), err
+}
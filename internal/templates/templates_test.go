@@ -0,0 +1,70 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad_EmbeddedLocales(t *testing.T) {
+	t.Parallel()
+
+	for _, locale := range []string{"", "pt-BR", "pt_br", "en", "en-US"} {
+		s, err := Load(locale, "")
+		if err != nil {
+			t.Fatalf("Load(%q): %v", locale, err)
+		}
+		for _, kind := range Kinds {
+			if _, err := s.Subject(kind, map[string]any{}); err == nil {
+				t.Fatalf("%s/%s: expected missingkey error with empty data", s.Locale, kind)
+			}
+		}
+		if _, ok, _ := s.HTML("finished", nil); !ok {
+			t.Fatalf("%s: finished.html not embedded", s.Locale)
+		}
+	}
+}
+
+func TestLoad_UnknownLocale(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Load("fr", ""); err == nil {
+		t.Fatalf("expected error for unsupported locale")
+	}
+}
+
+func TestLoad_Override(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := `{{define "subject"}}  Início
+	{{.Month}} {{end}}{{define "text"}}ok{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "started.txt"), []byte(src), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	s, err := Load("pt-BR", dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	subject, err := s.Subject("started", map[string]any{"Month": "2026-01"})
+	if err != nil || subject != "Início 2026-01" {
+		t.Fatalf("unexpected subject %q (%v)", subject, err)
+	}
+	if _, ok, _ := s.HTML("started", nil); ok {
+		t.Fatalf("started has no html template")
+	}
+}
+
+func TestLoad_OverrideMissingBlock(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "failed.txt"), []byte(`{{define "text"}}x{{end}}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_, err := Load("en", dir)
+	if err == nil || !strings.Contains(err.Error(), `"subject"`) {
+		t.Fatalf("expected missing subject error, got %v", err)
+	}
+}
@@ -45,10 +45,60 @@ func (ym YearMonth) Next() YearMonth {
 	return YearMonth{Year: y, Month: m}
 }
 
-func (ym YearMonth) HumanPTBR() string {
-	nomes := []string{
+func (ym YearMonth) Prev() YearMonth {
+	y := ym.Year
+	m := ym.Month - 1
+	if m < 1 {
+		m = 12
+		y--
+	}
+	return YearMonth{Year: y, Month: m}
+}
+
+// Locales accepted by Human.
+const (
+	LocalePTBR = "pt-BR"
+	LocaleEN   = "en"
+)
+
+var monthNames = map[string][]string{
+	LocalePTBR: {
 		"", "Janeiro", "Fevereiro", "Março", "Abril", "Maio", "Junho",
 		"Julho", "Agosto", "Setembro", "Outubro", "Novembro", "Dezembro",
+	},
+	LocaleEN: {
+		"", "January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December",
+	},
+}
+
+// NormalizeLocale maps a locale tag ("pt_BR", "pt", "en-US"...) to one of
+// the supported locales.
+func NormalizeLocale(locale string) (string, bool) {
+	l := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	switch {
+	case l == "" || l == "pt" || strings.HasPrefix(l, "pt-"):
+		return LocalePTBR, true
+	case l == "en" || strings.HasPrefix(l, "en-"):
+		return LocaleEN, true
+	}
+	return "", false
+}
+
+// Human formats the month for people ("Março de 2026", "March 2026").
+// Unknown locales fall back to pt-BR.
+func (ym YearMonth) Human(locale string) string {
+	l, ok := NormalizeLocale(locale)
+	if !ok {
+		l = LocalePTBR
 	}
-	return fmt.Sprintf("%s de %d", nomes[int(ym.Month)], ym.Year)
+	name := monthNames[l][int(ym.Month)]
+	if l == LocaleEN {
+		return fmt.Sprintf("%s %d", name, ym.Year)
+	}
+	return fmt.Sprintf("%s de %d", name, ym.Year)
+}
+
+func (ym YearMonth) HumanPTBR() string {
+	return ym.Human(LocalePTBR)
 }
@@ -35,6 +35,15 @@ func TestYearMonthNextAndString(t *testing.T) {
 	}
 }
 
+func TestYearMonthPrev(t *testing.T) {
+	t.Parallel()
+
+	got := (YearMonth{Year: 2026, Month: 1}).Prev()
+	if got.String() != "2025-12" {
+		t.Fatalf("unexpected prev: %s", got.String())
+	}
+}
+
 func TestYearMonthHumanPTBR(t *testing.T) {
 	t.Parallel()
 
@@ -44,3 +53,22 @@ func TestYearMonthHumanPTBR(t *testing.T) {
 	}
 }
 
+
+func TestYearMonthHuman(t *testing.T) {
+	t.Parallel()
+
+	ym := YearMonth{Year: 2026, Month: 3}
+	cases := map[string]string{
+		"pt-BR": "Março de 2026",
+		"pt_br": "Março de 2026",
+		"":      "Março de 2026",
+		"en":    "March 2026",
+		"en-US": "March 2026",
+		"xx":    "Março de 2026",
+	}
+	for locale, want := range cases {
+		if got := ym.Human(locale); got != want {
+			t.Fatalf("Human(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}